@@ -0,0 +1,311 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// commandSegment is one simple command of a shell pipeline or list.
+type commandSegment struct {
+	Args      []string
+	Redirects []string // targets of output redirections (> and >>)
+}
+
+// splitShellCommand splits a command line into simple commands. It understands
+// quoting, escapes, control operators and output redirections, which is enough
+// to find the arguments a command will act on. It is not a full shell parser:
+// expansions, subshells and heredocs are left as plain words.
+func splitShellCommand(command string) []commandSegment {
+	var (
+		segments []commandSegment
+		cur      commandSegment
+		word     strings.Builder
+		inWord   bool
+		redirect bool
+	)
+
+	flushWord := func() {
+		if !inWord {
+			return
+		}
+		w := word.String()
+		word.Reset()
+		inWord = false
+		if redirect {
+			cur.Redirects = append(cur.Redirects, w)
+			redirect = false
+			return
+		}
+		cur.Args = append(cur.Args, w)
+	}
+	flushSegment := func() {
+		flushWord()
+		if len(cur.Args) > 0 || len(cur.Redirects) > 0 {
+			segments = append(segments, cur)
+		}
+		cur = commandSegment{}
+		redirect = false
+	}
+
+	rs := []rune(command)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == '\\' && i+1 < len(rs):
+			i++
+			word.WriteRune(rs[i])
+			inWord = true
+		case r == '\'':
+			inWord = true
+			for i++; i < len(rs) && rs[i] != '\''; i++ {
+				word.WriteRune(rs[i])
+			}
+		case r == '"':
+			inWord = true
+			for i++; i < len(rs) && rs[i] != '"'; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) && strings.ContainsRune(`"\$`+"`", rs[i+1]) {
+					i++
+				}
+				word.WriteRune(rs[i])
+			}
+		case r == ' ' || r == '\t':
+			flushWord()
+		case r == ';' || r == '|' || r == '&' || r == '\n' || r == '(' || r == ')':
+			// "&>" is a redirection of both streams, not a control operator.
+			if r == '&' && i+1 < len(rs) && rs[i+1] == '>' {
+				flushWord()
+				i++
+				if i+1 < len(rs) && rs[i+1] == '>' {
+					i++
+				}
+				redirect = true
+				continue
+			}
+			flushSegment()
+		case r == '>':
+			// A word made only of digits directly before '>' is a file descriptor.
+			if inWord && isAllDigits(word.String()) {
+				word.Reset()
+				inWord = false
+			}
+			flushWord()
+			if i+1 < len(rs) && (rs[i+1] == '>' || rs[i+1] == '|') {
+				i++
+			}
+			// Duplications such as 2>&1 do not name a file.
+			if i+1 < len(rs) && rs[i+1] == '&' {
+				i++
+				for i+1 < len(rs) && (rs[i+1] == '-' || (rs[i+1] >= '0' && rs[i+1] <= '9')) {
+					i++
+				}
+				continue
+			}
+			redirect = true
+		case r == '<':
+			flushWord()
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	flushSegment()
+	return segments
+}
+
+func isAllDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// commandName strips wrappers (sudo, env, nice, ...) and variable assignments
+// from the front of a simple command and returns the program name and its
+// arguments.
+func commandName(args []string) (string, []string) {
+	for len(args) > 0 {
+		a := args[0]
+		switch {
+		case strings.Contains(a, "=") && !strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "="):
+			args = args[1:]
+		case a == "sudo" || a == "doas" || a == "env" || a == "nice" || a == "nohup" || a == "time" || a == "command" || a == "exec":
+			args = args[1:]
+			for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+				args = args[1:]
+			}
+		default:
+			return filepath.Base(a), args[1:]
+		}
+	}
+	return "", nil
+}
+
+// operands returns the non-option arguments, honouring "--". Options listed
+// in withValue consume the following argument.
+func operands(args []string, withValue ...string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			return append(out, args[i+1:]...)
+		}
+		if strings.HasPrefix(a, "-") && a != "-" {
+			for _, v := range withValue {
+				if a == v {
+					i++
+					break
+				}
+			}
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+func hasFlag(args []string, prefixes ...string) bool {
+	for _, a := range args {
+		if a == "--" {
+			return false
+		}
+		for _, p := range prefixes {
+			if strings.HasPrefix(a, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pathArguments returns the arguments of a simple command that name paths it
+// may modify or remove. Commands that only read are ignored.
+func pathArguments(name string, args []string) []string {
+	switch name {
+	case "rm", "rmdir", "unlink", "tee":
+		return operands(args)
+	case "truncate":
+		return operands(args, "-s", "--size", "-r", "--reference")
+	case "shred":
+		return operands(args, "-n", "--iterations", "-s", "--size")
+	case "mv":
+		return operands(args, "-t", "--target-directory", "-S", "--suffix")
+	case "cp", "install", "ln", "rsync":
+		ops := operands(args, "-t", "--target-directory", "-S", "--suffix", "-m", "--mode", "-o", "--owner", "-g", "--group", "-e")
+		if len(ops) < 2 {
+			return nil
+		}
+		return ops[len(ops)-1:]
+	case "chmod", "chown", "chgrp":
+		ops := operands(args, "--reference")
+		if len(ops) < 2 {
+			return nil
+		}
+		return ops[1:]
+	case "sed", "perl":
+		if !hasFlag(args, "-i", "--in-place", "-pi", "-ni") {
+			return nil
+		}
+		ops := operands(args, "-e", "-E", "-f", "--expression", "--file")
+		if !hasFlag(args, "-e", "-E", "-f", "--expression", "--file") && len(ops) > 0 {
+			ops = ops[1:] // the first operand is the script
+		}
+		return ops
+	case "dd":
+		for _, a := range args {
+			if strings.HasPrefix(a, "of=") {
+				return []string{strings.TrimPrefix(a, "of=")}
+			}
+		}
+	case "find":
+		if !hasFlag(args, "-delete") && !strings.Contains(strings.Join(args, " "), "-exec rm") {
+			return nil
+		}
+		var roots []string
+		for _, a := range args {
+			if strings.HasPrefix(a, "-") || a == "(" || a == "!" {
+				break
+			}
+			roots = append(roots, a)
+		}
+		if len(roots) == 0 {
+			roots = []string{"."}
+		}
+		return roots
+	}
+	return nil
+}
+
+// creatingCmds are the commands whose path arguments may name files that
+// do not exist yet.
+var creatingCmds = []string{"mv", "cp", "install", "ln", "rsync", "tee", "truncate", "dd"}
+
+// touchedPaths returns the local paths a command is expected to modify,
+// remove or create, as absolute paths. Globs are expanded and paths nested
+// inside another result are folded into it. Missing paths are kept only
+// where the command may create them (redirections, copy and move targets),
+// so that undo can remove what the command created.
+func touchedPaths(command string) []string {
+	home, _ := os.UserHomeDir()
+
+	var candidates []string
+	mayCreate := map[string]bool{}
+	for _, seg := range splitShellCommand(command) {
+		name, args := commandName(seg.Args)
+		for _, p := range pathArguments(name, args) {
+			candidates = append(candidates, p)
+			mayCreate[p] = mayCreate[p] || contains(creatingCmds, name)
+		}
+		for _, p := range seg.Redirects {
+			candidates = append(candidates, p)
+			mayCreate[p] = true
+		}
+	}
+
+	seen := map[string]bool{}
+	var paths []string
+	for _, c := range candidates {
+		create := mayCreate[c]
+		if c == "" || c == "/dev/null" || strings.HasPrefix(c, "/dev/") || strings.Contains(c, "$") {
+			continue
+		}
+		if home != "" && (c == "~" || strings.HasPrefix(c, "~/")) {
+			c = filepath.Join(home, strings.TrimPrefix(c, "~"))
+		}
+		matches := []string{c}
+		if strings.ContainsAny(c, "*?[") {
+			matches, _ = filepath.Glob(c)
+		}
+		for _, m := range matches {
+			abs, err := filepath.Abs(m)
+			if err != nil || seen[abs] {
+				continue
+			}
+			if _, err := os.Lstat(abs); err != nil && (!create || !os.IsNotExist(err)) {
+				continue
+			}
+			seen[abs] = true
+			paths = append(paths, abs)
+		}
+	}
+
+	var out []string
+	for _, p := range paths {
+		nested := false
+		for _, q := range paths {
+			if p != q && strings.HasPrefix(p, q+string(filepath.Separator)) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			out = append(out, p)
+		}
+	}
+	return out
+}
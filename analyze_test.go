@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitShellCommand(t *testing.T) {
+	segs := splitShellCommand(`sudo rm -rf "my dir" && echo 'a;b' > out.txt 2>&1 | tee -a log`)
+	if len(segs) != 3 {
+		t.Fatalf("expected 3 segments, got %#v", segs)
+	}
+	if !reflect.DeepEqual(segs[0].Args, []string{"sudo", "rm", "-rf", "my dir"}) {
+		t.Fatalf("unexpected first segment: %#v", segs[0])
+	}
+	if !reflect.DeepEqual(segs[1].Args, []string{"echo", "a;b"}) || !reflect.DeepEqual(segs[1].Redirects, []string{"out.txt"}) {
+		t.Fatalf("unexpected second segment: %#v", segs[1])
+	}
+	if !reflect.DeepEqual(segs[2].Args, []string{"tee", "-a", "log"}) {
+		t.Fatalf("unexpected third segment: %#v", segs[2])
+	}
+}
+
+func TestTouchedPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.log", "b.log", "keep.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		command string
+		want    []string
+	}{
+		{"ls -la " + dir, nil},
+		{"rm " + filepath.Join(dir, "*.log"), []string{filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")}},
+		{"sed -i 's/a/b/' " + filepath.Join(dir, "keep.txt"), []string{filepath.Join(dir, "keep.txt")}},
+		{"sed 's/a/b/' " + filepath.Join(dir, "keep.txt"), nil},
+		{"cp /etc/hostname " + filepath.Join(dir, "keep.txt"), []string{filepath.Join(dir, "keep.txt")}},
+		{"echo hi > " + filepath.Join(dir, "keep.txt"), []string{filepath.Join(dir, "keep.txt")}},
+		{"rm -rf " + dir + " " + filepath.Join(dir, "sub"), []string{dir}},
+		{"rm " + filepath.Join(dir, "missing"), nil},
+		{"cp /etc/hostname " + filepath.Join(dir, "new.txt"), []string{filepath.Join(dir, "new.txt")}},
+		{"echo hi > " + filepath.Join(dir, "new.txt"), []string{filepath.Join(dir, "new.txt")}},
+		{"mv " + filepath.Join(dir, "keep.txt") + " " + filepath.Join(dir, "moved.txt"), []string{filepath.Join(dir, "keep.txt"), filepath.Join(dir, "moved.txt")}},
+		{"cp /etc/hostname " + filepath.Join(dir, "sub", "new.txt"), []string{filepath.Join(dir, "sub", "new.txt")}},
+		{"rm " + filepath.Join(dir, "*.tmp"), nil},
+		{"rm -r " + filepath.Join(dir, "sub"), []string{filepath.Join(dir, "sub")}},
+		{"mv -n " + filepath.Join(dir, "keep.txt") + " " + filepath.Join(dir, "moved.txt"), []string{filepath.Join(dir, "keep.txt"), filepath.Join(dir, "moved.txt")}},
+		{"truncate -s 0 " + filepath.Join(dir, "a.log"), []string{filepath.Join(dir, "a.log")}},
+		{"shred -n 3 " + filepath.Join(dir, "b.log"), []string{filepath.Join(dir, "b.log")}},
+	}
+	for _, c := range cases {
+		if got := touchedPaths(c.command); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.command, got, c.want)
+		}
+	}
+}
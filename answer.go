@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// shellBuiltins are command names that never resolve through PATH but are
+// valid first words of a command in the shells how targets.
+var shellBuiltins = []string{
+	".", ":", "[", "[[", "alias", "bg", "bind", "break", "builtin", "case", "cd", "command",
+	"continue", "declare", "dirs", "disown", "echo", "eval", "exec", "exit", "export", "false",
+	"fc", "fg", "for", "function", "getopts", "hash", "history", "if", "jobs", "kill", "let",
+	"local", "popd", "printf", "pushd", "pwd", "read", "readonly", "return", "select", "set",
+	"shift", "shopt", "source", "test", "time", "times", "trap", "true", "type", "typeset",
+	"ulimit", "umask", "unalias", "unset", "until", "wait", "while",
+	// zsh and fish
+	"autoload", "bindkey", "setopt", "unsetopt", "abbr", "functions", "begin", "contains",
+	"string", "math", "status", "argparse",
+	// cmd.exe
+	"cls", "copy", "del", "dir", "md", "mkdir", "move", "ren", "rd", "type", "ver", "vol",
+}
+
+// powerShellCmdletRe matches Verb-Noun cmdlet names such as Get-ChildItem.
+var powerShellCmdletRe = regexp.MustCompile(`^[A-Z][a-z]+-[A-Za-z]+$`)
+
+// looksLikeAnswer guesses whether a plain-text reply is a direct answer
+// (rule 7 of the prompt) rather than a command. It only says so when the
+// first word is not something the shell can run and the text reads like a
+// sentence, so an uninstalled tool is still treated as a command.
+func looksLikeAnswer(sys Sys, text string) bool {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return false
+	}
+	segs := splitShellCommand(text)
+	if len(segs) == 0 {
+		return false
+	}
+	name, _ := commandName(segs[0].Args)
+	switch {
+	case name == "" || strings.ContainsAny(name, `/\$({`):
+		return false
+	case contains(shellBuiltins, strings.ToLower(name)), powerShellCmdletRe.MatchString(name):
+		return false
+	}
+	if _, err := sys.LookPath(name); err == nil {
+		return false
+	}
+	return readsLikeProse(text)
+}
+
+// sentenceEndRe matches a word ending in sentence punctuation, but not a
+// lone "." argument.
+var sentenceEndRe = regexp.MustCompile(`[\p{L}\d][.!?]["')]?$`)
+
+// readsLikeProse reports whether text looks like a sentence of any length:
+// it ends with sentence punctuation, or it starts with a capital letter and
+// has no options or shell operators.
+func readsLikeProse(text string) bool {
+	if sentenceEndRe.MatchString(text) {
+		return true
+	}
+	words := strings.Fields(text)
+	if len(words) == 0 || !unicode.IsUpper([]rune(words[0])[0]) {
+		return false
+	}
+	for _, w := range words {
+		if strings.HasPrefix(w, "-") || strings.ContainsAny(w, "|&;<>=`$") {
+			return false
+		}
+	}
+	return true
+}
+
+// printAnswer prints a direct answer as shell comments, so that pasting it
+// or accepting it from the shell integration does nothing.
+func printAnswer(w io.Writer, answer string) error {
+	for _, line := range strings.Split(strings.TrimSpace(answer), "\n") {
+		if _, err := fmt.Fprintf(w, "# %s\n", strings.TrimSpace(line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLooksLikeAnswer(t *testing.T) {
+	fs := fakeSys{goos: "linux", look: map[string]bool{"ls": true, "find": true, "sudo": true}}
+	cases := []struct {
+		text string
+		want bool
+	}{
+		{"ls -la", false},
+		{"sudo find / -name core", false},
+		{"cd /tmp && ls", false},
+		{"export EDITOR=vim", false},
+		{"for f in *.txt; do echo $f; done", false},
+		{"./configure --prefix=/usr", false},
+		{"Get-ChildItem -Recurse -Filter *.log", false},
+		{"FOO=1 ls", false},
+		// An uninstalled tool is still a command.
+		{"rg --files -g '*.go'", false},
+		{"SSH listens on port 22 by default.", true},
+		{"The default port is 22", true},
+		{"port 22, unless sshd_config says otherwise.", true},
+		{"No.", true},
+		{"Port 22.", true},
+		{"Yes", true},
+		{"Port 22", true},
+		{"rg --files", false},
+		{"mytool .", false},
+		{"Makefile-gen --all", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if got := looksLikeAnswer(fs, c.text); got != c.want {
+			t.Errorf("looksLikeAnswer(%q) = %v, want %v", c.text, got, c.want)
+		}
+	}
+}
+
+func TestPrintAnswer(t *testing.T) {
+	var b bytes.Buffer
+	if err := printAnswer(&b, "Port 22.\nChange it in /etc/ssh/sshd_config.\n"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "# Port 22.\n# Change it in /etc/ssh/sshd_config.\n"; b.String() != want {
+		t.Fatalf("got %q, want %q", b.String(), want)
+	}
+}
+
+func TestRoot_PlainAnswerIsNotRun(t *testing.T) {
+	_ = resetForTest(t)
+	viper.Set("api_key", "k")
+	orig := llmQuery
+	t.Cleanup(func() { llmQuery = orig })
+	llmQuery = func(req LLMRequest) (LLMResponse, error) {
+		return LLMResponse{Content: "SSH listens on port 22 by default."}, nil
+	}
+
+	out, err := executeRoot(t, "--run", "--yes", "which", "port", "does", "ssh", "use")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "# SSH listens on port 22 by default.\n" {
+		t.Fatalf("stdout = %q", out)
+	}
+
+	runFlag, yesFlag = false, false
+	out, err = executeRoot(t, "last")
+	if err != nil || out != "# SSH listens on port 22 by default.\n" {
+		t.Fatalf("last = %q, %v", out, err)
+	}
+	_, err = executeRoot(t, "last", "--run", "--yes")
+	if exitCode(err) != exitRefused || !strings.Contains(err.Error(), "answer") {
+		t.Fatalf("last --run on an answer should be refused, got %v", err)
+	}
+}
+
+func TestRoot_ShortAnswerIsNotRun(t *testing.T) {
+	for _, answer := range []string{"No.", "Port 22."} {
+		_ = resetForTest(t)
+		viper.Set("api_key", "k")
+		orig := llmQuery
+		t.Cleanup(func() { llmQuery = orig })
+		llmQuery = func(req LLMRequest) (LLMResponse, error) {
+			return LLMResponse{Content: answer}, nil
+		}
+
+		out, err := executeRoot(t, "--run", "--yes", "is", "telnet", "encrypted")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "# "+answer+"\n" {
+			t.Fatalf("%s: stdout = %q", answer, out)
+		}
+	}
+}
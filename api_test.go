@@ -31,18 +31,21 @@ func TestQueryLLM_OK(t *testing.T) {
 			t.Fatalf("unexpected messages: %#v", body.Messages)
 		}
 		w.Header().Set("Content-Type", "application/json")
-		if _, err := io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"echo hello"}}]}`); err != nil {
+		if _, err := io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"echo hello"}}],"usage":{"prompt_tokens":120,"completion_tokens":3,"total_tokens":123}}`); err != nil {
 			t.Fatalf("write response: %v", err)
 		}
 	}))
 	defer srv.Close()
 
-	cmd, err := queryLLM(srv.URL, "test", "say hi", "mistral", true)
+	resp, err := queryLLM(LLMRequest{Endpoint: srv.URL, APIKey: "test", Query: "say hi", Model: "mistral", RefererNeeded: true})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if cmd != "echo hello" {
-		t.Fatalf("got %q", cmd)
+	if resp.Content != "echo hello" {
+		t.Fatalf("got %q", resp.Content)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 123 {
+		t.Fatalf("unexpected usage %+v", resp.Usage)
 	}
 }
 
@@ -55,7 +58,7 @@ func TestQueryLLM_ErrorStatus(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	_, err := queryLLM(srv.URL, "k", "q", "m", false)
+	_, err := queryLLM(LLMRequest{Endpoint: srv.URL, APIKey: "k", Query: "q", Model: "m"})
 	if err == nil {
 		t.Fatal("expected error")
 	}
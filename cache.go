@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const defaultCacheTTLHours = 24 * 7
+
+var (
+	noCacheFlag bool
+	refreshFlag bool
+)
+
+// cachedResponse is one file in the response cache. Content is the reply
+// to the redacted query, exactly as the model returned it.
+type cachedResponse struct {
+	Created    time.Time `json:"created"`
+	Content    string    `json:"content"`
+	Structured bool      `json:"structured,omitempty"`
+}
+
+// normalizeQuery makes trivially different phrasings of a query share a
+// cache entry: case, spacing and trailing punctuation are ignored.
+func normalizeQuery(q string) string {
+	q = strings.Join(strings.Fields(strings.ToLower(q)), " ")
+	return strings.TrimRight(q, "?!. ")
+}
+
+// responseCacheKey identifies a reply. The system prompt hash covers
+// everything the prompt says about the machine, directory and config, so a
+// changed environment never reuses a stale command.
+func responseCacheKey(provider string, r LLMRequest) string {
+	prompt := sha256.Sum256([]byte(r.SystemPrompt))
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%x\x00%s\x00%s\x00%s\x00%t",
+		normalizeQuery(r.Query), prompt, provider, r.Endpoint, r.Model, r.Structured)))
+	return hex.EncodeToString(sum[:])
+}
+
+func responseCacheDir() (string, error) {
+	dir, err := howConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cache"), nil
+}
+
+func cacheTTL() time.Duration {
+	if !viper.GetBool("cache.enabled") || noCacheFlag {
+		return 0
+	}
+	return time.Duration(viper.GetInt("cache.ttl_hours")) * time.Hour
+}
+
+// pendingCache is a fresh reply that is written to the response cache only
+// once runQuery has accepted it, so that a malformed, empty, multi-line or
+// refused reply is asked for again next time. A nil *pendingCache stores
+// nothing.
+type pendingCache struct {
+	dir, path string
+	ttl       time.Duration
+	resp      LLMResponse
+}
+
+// store writes the reply to the cache (best-effort, like the tool
+// inventory cache) and prunes expired entries.
+func (p *pendingCache) store() {
+	if p == nil {
+		return
+	}
+	if b, err := json.Marshal(cachedResponse{Created: time.Now(), Content: p.resp.Content, Structured: p.resp.Structured}); err == nil {
+		if os.MkdirAll(p.dir, 0700) == nil {
+			_ = os.WriteFile(p.path, b, 0600)
+		}
+	}
+	pruneResponseCache(p.dir, p.ttl)
+}
+
+// cachedQuery answers r from the response cache when it holds a reply
+// younger than cache.ttl_hours, and asks the model otherwise; that reply
+// is returned with a pendingCache to store once it has been accepted.
+// --refresh skips the lookup; --no-cache skips the cache entirely.
+func cachedQuery(provider string, r LLMRequest) (LLMResponse, *pendingCache, error) {
+	ttl := cacheTTL()
+	if ttl <= 0 {
+		resp, err := llmQuery(r)
+		return resp, nil, err
+	}
+	dir, err := responseCacheDir()
+	if err != nil {
+		resp, err := llmQuery(r)
+		return resp, nil, err
+	}
+	path := filepath.Join(dir, responseCacheKey(provider, r)+".json")
+
+	if !refreshFlag {
+		var c cachedResponse
+		if b, err := os.ReadFile(path); err == nil && json.Unmarshal(b, &c) == nil && time.Since(c.Created) < ttl {
+			if debug {
+				fmt.Fprintf(os.Stderr, "Response cache: hit (%s old)\n", time.Since(c.Created).Round(time.Second))
+			}
+			return LLMResponse{Content: c.Content, Structured: c.Structured}, nil, nil
+		}
+	}
+
+	resp, err := llmQuery(r)
+	if err != nil {
+		return resp, nil, err
+	}
+	return resp, &pendingCache{dir: dir, path: path, ttl: ttl, resp: resp}, nil
+}
+
+// pruneResponseCache removes expired entries so the cache does not grow
+// without bound.
+func pruneResponseCache(dir string, ttl time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if fi, err := e.Info(); err == nil && time.Since(fi.ModTime()) > ttl {
+			_ = os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
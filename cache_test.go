@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	for _, q := range []string{"disk usage of current dir sorted", "  Disk usage of   current dir sorted?", "DISK USAGE OF CURRENT DIR SORTED."} {
+		if got := normalizeQuery(q); got != "disk usage of current dir sorted" {
+			t.Errorf("normalizeQuery(%q) = %q", q, got)
+		}
+	}
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	base := LLMRequest{Endpoint: openAiURL, SystemPrompt: "prompt", Query: "list files", Model: "m"}
+	key := responseCacheKey(providerOpenAI, base)
+
+	same := base
+	same.Query = "List files?"
+	if responseCacheKey(providerOpenAI, same) != key {
+		t.Error("normalized queries should share a key")
+	}
+	for name, r := range map[string]LLMRequest{
+		"prompt":     {Endpoint: openAiURL, SystemPrompt: "other prompt", Query: "list files", Model: "m"},
+		"model":      {Endpoint: openAiURL, SystemPrompt: "prompt", Query: "list files", Model: "n"},
+		"structured": {Endpoint: openAiURL, SystemPrompt: "prompt", Query: "list files", Model: "m", Structured: true},
+	} {
+		if responseCacheKey(providerOpenAI, r) == key {
+			t.Errorf("a different %s should change the key", name)
+		}
+	}
+	if responseCacheKey(providerOpenRouter, base) == key {
+		t.Error("a different provider should change the key")
+	}
+}
+
+func TestBuildSystemPrompt_IsDeterministic(t *testing.T) {
+	_ = resetForTest(t)
+	first, err := buildSystemPrompt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if p, _ := buildSystemPrompt(); p != first {
+			t.Fatalf("system prompt changed between calls:\n%s\n---\n%s", first, p)
+		}
+	}
+}
+
+func TestRoot_ResponseCache(t *testing.T) {
+	cfgDir := resetForTest(t)
+	viper.Set("api_key", "k")
+	orig := llmQuery
+	t.Cleanup(func() { llmQuery = orig })
+	calls := 0
+	llmQuery = func(req LLMRequest) (LLMResponse, error) {
+		calls++
+		return LLMResponse{Content: "du -sh * | sort -h"}, nil
+	}
+	query := func(args ...string) {
+		t.Helper()
+		noCacheFlag, refreshFlag = false, false
+		out, err := executeRoot(t, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "du -sh * | sort -h\n" {
+			t.Fatalf("stdout = %q", out)
+		}
+	}
+
+	query("disk", "usage", "sorted")
+	query("Disk", "usage", "sorted?")
+	if calls != 1 {
+		t.Fatalf("expected the second query to be served from the cache, got %d calls", calls)
+	}
+	query("--refresh", "disk", "usage", "sorted")
+	query("--no-cache", "disk", "usage", "sorted")
+	if calls != 3 {
+		t.Fatalf("--refresh and --no-cache should ask the model, got %d calls", calls)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(cfgDir, "cache"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one cache entry, got %v, %v", entries, err)
+	}
+
+	if err := updateConfig(map[string]any{"cache.enabled": false}); err != nil {
+		t.Fatal(err)
+	}
+	query("disk", "usage", "sorted")
+	if calls != 4 {
+		t.Fatalf("cache.enabled=false should ask the model, got %d calls", calls)
+	}
+}
+
+func TestRoot_RejectedReplyIsNotCached(t *testing.T) {
+	for _, bad := range []LLMResponse{
+		{Content: "cd /tmp\nrm -rf build"},
+		{Content: "   "},
+		{Content: `{"type":"command","command":"ls"`, Structured: true},
+		{Content: `{"type":"refusal","command":"","explanation":"No.","requires_sudo":false,"destructive":false}`, Structured: true},
+	} {
+		_ = resetForTest(t)
+		viper.Set("api_key", "k")
+		orig := llmQuery
+		t.Cleanup(func() { llmQuery = orig })
+		calls := 0
+		llmQuery = func(req LLMRequest) (LLMResponse, error) {
+			calls++
+			return bad, nil
+		}
+
+		for i := 0; i < 2; i++ {
+			if _, err := executeRoot(t, "clean", "the", "build"); err == nil {
+				t.Fatalf("%q: expected the reply to be rejected", bad.Content)
+			}
+		}
+		if calls != 2 {
+			t.Fatalf("%q: rejected reply served from the cache (%d calls)", bad.Content, calls)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const maxCandidates = 9
+
+var candidatesFlag int
+
+// Candidate is one of the alternatives requested with -n.
+type Candidate struct {
+	Command     string
+	Description string
+}
+
+// candidatesInstruction is appended to the system prompt when more than
+// one command is requested, overriding the single-command output rules.
+func candidatesInstruction(n int) string {
+	return fmt.Sprintf(`
+Alternatives requested: instead of a single command, output exactly %d different commands, best first, one per line, each formatted as:
+<command> ## <one-line description of what it does and how it differs from the others>
+This replaces rules 1, 2 and 6 for the output format only; every other rule still applies to each command.
+`, n)
+}
+
+func validateCandidates(n int) error {
+	if n < 1 || n > maxCandidates {
+		return fmt.Errorf("-n must be between 1 and %d", maxCandidates)
+	}
+	return nil
+}
+
+var listMarkerRe = regexp.MustCompile(`^(\d+[.)]|[-*])\s+`)
+
+// parseCandidates reads up to n "<command> ## <description>" lines,
+// tolerating list numbering, code fences and lines without a description.
+func parseCandidates(response string, n int) ([]Candidate, error) {
+	var cands []Candidate
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "```") {
+			continue
+		}
+		line = listMarkerRe.ReplaceAllString(line, "")
+
+		var c Candidate
+		if i := strings.LastIndex(line, " ## "); i >= 0 {
+			c.Command, c.Description = line[:i], strings.TrimSpace(line[i+4:])
+		} else {
+			c.Command = line
+		}
+		c.Command = strings.Trim(strings.TrimSpace(c.Command), "`")
+		if c.Command == "" {
+			continue
+		}
+		cands = append(cands, c)
+		if len(cands) == n {
+			break
+		}
+	}
+	if len(cands) == 0 {
+		return nil, errors.New("model returned no commands")
+	}
+	return cands, nil
+}
+
+// chooseCandidate lists cands on out and reads the user's choice from in.
+// It returns the index of the chosen candidate.
+func chooseCandidate(in io.Reader, out io.Writer, cands []Candidate) (int, error) {
+	for i, c := range cands {
+		_, _ = fmt.Fprintf(out, "%d) %s\n", i+1, c.Command)
+		if c.Description != "" {
+			_, _ = fmt.Fprintf(out, "   %s\n", c.Description)
+		}
+	}
+	r := bufio.NewReader(in)
+	for {
+		_, _ = fmt.Fprintf(out, "Choose [1-%d] (Enter for 1, q to cancel): ", len(cands))
+		line, err := r.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		switch {
+		case answer == "" && err == nil:
+			return 0, nil
+		case answer == "q":
+			return 0, errors.New("no command chosen")
+		}
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= len(cands) {
+			return n - 1, nil
+		}
+		if err != nil {
+			return 0, errors.New("no command chosen")
+		}
+	}
+}
+
+// pickCandidate asks which candidate to use, showing commands with their
+// redacted values restored. Without a terminal the first one is used.
+func pickCandidate(cands []Candidate, redactions *Redactions) (int, error) {
+	if len(cands) == 1 {
+		return 0, nil
+	}
+	if !isTTY(os.Stdin) || !isTTY(os.Stderr) {
+		fmt.Fprintf(os.Stderr, "Not a terminal; using the first of %d alternatives.\n", len(cands))
+		return 0, nil
+	}
+	shown := make([]Candidate, len(cands))
+	for i, c := range cands {
+		shown[i] = Candidate{Command: redactions.Restore(c.Command), Description: redactions.Restore(c.Description)}
+	}
+	return chooseCandidate(os.Stdin, os.Stderr, shown)
+}
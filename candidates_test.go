@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseCandidates(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		n        int
+		want     []Candidate
+	}{
+		{
+			name:     "plain",
+			response: "du -sh * ## Size of each entry\nncdu ## Interactive browser",
+			n:        2,
+			want:     []Candidate{{"du -sh *", "Size of each entry"}, {"ncdu", "Interactive browser"}},
+		},
+		{
+			name:     "numbered in a fence",
+			response: "```\n1. `ls -la` ## Long listing\n2) ls -1 ## One per line\n```",
+			n:        3,
+			want:     []Candidate{{"ls -la", "Long listing"}, {"ls -1", "One per line"}},
+		},
+		{
+			name:     "extra lines are dropped",
+			response: "a ## x\nb ## y\nc ## z",
+			n:        2,
+			want:     []Candidate{{"a", "x"}, {"b", "y"}},
+		},
+		{
+			name:     "no description and ## inside the command",
+			response: "- echo '## header' ## Print a heading\n- ls",
+			n:        2,
+			want:     []Candidate{{"echo '## header'", "Print a heading"}, {"ls", ""}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCandidates(tt.response, tt.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseCandidates("\n```\n```\n", 2); err == nil {
+		t.Fatal("expected an error for an empty response")
+	}
+}
+
+func TestChooseCandidate(t *testing.T) {
+	cands := []Candidate{{"ls", "list"}, {"ls -la", "long"}, {"tree", ""}}
+	tests := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{"2\n", 1, false},
+		{"\n", 0, false},
+		{"7\nabc\n3\n", 2, false},
+		{"q\n", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		got, err := chooseCandidate(strings.NewReader(tt.input), &out, cands)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Fatalf("input %q: got %d, %v", tt.input, got, err)
+		}
+		if !strings.Contains(out.String(), "2) ls -la\n   long\n3) tree\nChoose [1-3]") {
+			t.Fatalf("unexpected listing:\n%s", out.String())
+		}
+	}
+}
+
+func TestRoot_Candidates(t *testing.T) {
+	_ = resetForTest(t)
+	viper.Set("api_key", "dummy-test-key")
+
+	var prompt string
+	orig := llmQuery
+	t.Cleanup(func() { llmQuery = orig })
+	llmQuery = func(req LLMRequest) (LLMResponse, error) {
+		prompt, _ = buildSystemPrompt()
+		return LLMResponse{Content: "du -sh * ## Size of each entry\nncdu ## Interactive browser\nduf ## Disk usage per mount"}, nil
+	}
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetArgs([]string{"-n", "3", "what", "uses", "space"})
+	t.Cleanup(func() { rootCmd.SetOut(nil); rootCmd.SetArgs(nil) })
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(prompt, "output exactly 3 different commands") {
+		t.Fatalf("prompt does not ask for alternatives:\n%s", prompt)
+	}
+	// Tests have no terminal, so the first alternative is used.
+	if out.String() != "du -sh *\n" {
+		t.Fatalf("stdout = %q", out.String())
+	}
+	entry, err := readLastHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Choice != 1 || len(entry.Alternatives) != 3 || entry.Alternatives[2] != "duf" {
+		t.Fatalf("unexpected history entry %+v", entry)
+	}
+}
+
+func TestRoot_CandidatesOutOfRange(t *testing.T) {
+	_ = resetForTest(t)
+	rootCmd.SetArgs([]string{"-n", "20", "list", "files"})
+	t.Cleanup(func() { rootCmd.SetArgs(nil) })
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "between 1 and 9") {
+		t.Fatalf("expected a range error, got %v", err)
+	}
+}
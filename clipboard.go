@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var copyFlag bool
+
+// clipboardTool is an external command that reads the clipboard contents
+// from stdin. Env lists variables of which at least one must be set for
+// the tool to reach a clipboard (e.g. a Wayland or X11 display).
+type clipboardTool struct {
+	Cmd  string
+	Args []string
+	Env  []string
+	OS   []string
+}
+
+// clipboardTools are tried in order; OSC 52 is the last resort.
+var clipboardTools = []clipboardTool{
+	{Cmd: "wl-copy", Env: []string{"WAYLAND_DISPLAY"}},
+	{Cmd: "xclip", Args: []string{"-selection", "clipboard"}, Env: []string{"DISPLAY"}},
+	{Cmd: "xsel", Args: []string{"--clipboard", "--input"}, Env: []string{"DISPLAY"}},
+	{Cmd: "pbcopy", OS: []string{"darwin"}},
+	{Cmd: "clip", OS: []string{"windows"}},
+	// WSL reaches the Windows clipboard through the Windows binary.
+	{Cmd: "clip.exe", Env: []string{"WSL_DISTRO_NAME", "WSL_INTEROP"}},
+	// -w also forwards the buffer to the outer terminal's clipboard (tmux 3.2+).
+	{Cmd: "tmux", Args: []string{"load-buffer", "-w", "-"}, Env: []string{"TMUX"}},
+}
+
+// clipboardTimeout bounds a clipboard tool run.
+const clipboardTimeout = 5 * time.Second
+
+// clipboardRun runs a clipboard tool with text on stdin. Its output is not
+// captured: xclip and xsel fork a child that keeps serving the selection,
+// and a pipe it inherits would never reach EOF.
+var clipboardRun = func(path string, args []string, text string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), clipboardTimeout)
+	defer cancel()
+	c := exec.CommandContext(ctx, path, args...)
+	c.Stdin = strings.NewReader(text)
+	c.WaitDelay = time.Second
+	return c.Run()
+}
+
+// openTerminal returns where OSC 52 sequences are written: the controlling
+// terminal, so that stdout stays clean even when it is piped.
+var openTerminal = func() (io.WriteCloser, error) {
+	if f, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		return f, nil
+	}
+	if isTTY(os.Stderr) {
+		return nopWriteCloser{os.Stderr}, nil
+	}
+	return nil, errors.New("no terminal for OSC 52")
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func copyEnabled() bool {
+	return copyFlag || viper.GetBool("copy")
+}
+
+func (t clipboardTool) usable(sys Sys) bool {
+	if len(t.OS) > 0 && !contains(t.OS, sys.GOOS()) {
+		return false
+	}
+	if len(t.Env) > 0 {
+		found := false
+		for _, e := range t.Env {
+			if sys.Env(e) != "" {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	_, err := sys.LookPath(t.Cmd)
+	return err == nil
+}
+
+// osc52 returns the escape sequence that asks the terminal to set its
+// clipboard, which also works over SSH. Inside tmux the sequence is wrapped
+// so tmux passes it through to the outer terminal.
+func osc52(sys Sys, text string) string {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	if sys.Env("TMUX") != "" {
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	return seq
+}
+
+// copyToClipboard puts text on the clipboard with the first tool that works
+// and returns its name. Nothing is ever written to stdout.
+func copyToClipboard(sys Sys, text string) (string, error) {
+	var errs []error
+	for _, t := range clipboardTools {
+		if !t.usable(sys) {
+			continue
+		}
+		path, _ := sys.LookPath(t.Cmd)
+		err := clipboardRun(path, t.Args, text)
+		if err == nil {
+			return t.Cmd, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", t.Cmd, err))
+	}
+
+	w, err := openTerminal()
+	if err != nil {
+		return "", errors.Join(append(errs, err)...)
+	}
+	defer func() { _ = w.Close() }()
+	if _, err := io.WriteString(w, osc52(sys, text)); err != nil {
+		return "", errors.Join(append(errs, err)...)
+	}
+	return "OSC 52", nil
+}
+
+// copyCommand copies command when --copy or the copy setting asks for it,
+// reporting the outcome on stderr.
+func copyCommand(command string) {
+	if !copyEnabled() {
+		return
+	}
+	method, err := copyToClipboard(defaultSys, command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Could not copy to clipboard: %v\n", err)
+		return
+	}
+	if isTTY(os.Stderr) {
+		fmt.Fprintf(os.Stderr, "📋 Copied to clipboard (%s)\n", method)
+	}
+}
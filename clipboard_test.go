@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+type clipboardCall struct {
+	path string
+	args []string
+	text string
+}
+
+func stubClipboard(t *testing.T, fail map[string]bool) (*[]clipboardCall, *bytes.Buffer) {
+	t.Helper()
+	var calls []clipboardCall
+	var term bytes.Buffer
+	oldRun, oldTerm := clipboardRun, openTerminal
+	clipboardRun = func(path string, args []string, text string) error {
+		calls = append(calls, clipboardCall{path, args, text})
+		if fail[path] {
+			return errors.New("failed")
+		}
+		return nil
+	}
+	openTerminal = func() (io.WriteCloser, error) { return nopWriteCloser{&term}, nil }
+	t.Cleanup(func() { clipboardRun, openTerminal = oldRun, oldTerm })
+	return &calls, &term
+}
+
+func TestCopyToClipboard_Wayland(t *testing.T) {
+	calls, _ := stubClipboard(t, nil)
+	fs := fakeSys{goos: "linux", env: map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, look: map[string]bool{"wl-copy": true, "xclip": true}}
+
+	method, err := copyToClipboard(fs, "ls -la")
+	if err != nil || method != "wl-copy" {
+		t.Fatalf("method %q, err %v", method, err)
+	}
+	if len(*calls) != 1 || (*calls)[0].path != "/bin/wl-copy" || (*calls)[0].text != "ls -la" {
+		t.Fatalf("unexpected calls %+v", *calls)
+	}
+}
+
+func TestCopyToClipboard_FallsBackToXsel(t *testing.T) {
+	calls, _ := stubClipboard(t, map[string]bool{"/bin/xclip": true})
+	fs := fakeSys{goos: "linux", env: map[string]string{"DISPLAY": ":0"}, look: map[string]bool{"wl-copy": true, "xclip": true, "xsel": true}}
+
+	method, err := copyToClipboard(fs, "ls")
+	if err != nil || method != "xsel" {
+		t.Fatalf("method %q, err %v", method, err)
+	}
+	// wl-copy is skipped without a Wayland display.
+	if len(*calls) != 2 || (*calls)[0].path != "/bin/xclip" || strings.Join((*calls)[1].args, " ") != "--clipboard --input" {
+		t.Fatalf("unexpected calls %+v", *calls)
+	}
+}
+
+func TestCopyToClipboard_OSC52OverSSH(t *testing.T) {
+	calls, term := stubClipboard(t, nil)
+	fs := fakeSys{goos: "linux", env: map[string]string{"SSH_TTY": "/dev/pts/1"}, look: map[string]bool{"xclip": true}}
+
+	method, err := copyToClipboard(fs, "ls")
+	if err != nil || method != "OSC 52" {
+		t.Fatalf("method %q, err %v", method, err)
+	}
+	if len(*calls) != 0 {
+		t.Fatalf("no tool should run without a display, got %+v", *calls)
+	}
+	if got := term.String(); got != "\x1b]52;c;bHM=\a" {
+		t.Fatalf("unexpected sequence %q", got)
+	}
+}
+
+func TestCopyToClipboard_TmuxFallsBackToWrappedOSC52(t *testing.T) {
+	_, term := stubClipboard(t, map[string]bool{"/bin/tmux": true})
+	fs := fakeSys{goos: "linux", env: map[string]string{"TMUX": "/tmp/tmux-1000/default,1,0"}, look: map[string]bool{"tmux": true}}
+
+	method, err := copyToClipboard(fs, "ls")
+	if err != nil || method != "OSC 52" {
+		t.Fatalf("method %q, err %v", method, err)
+	}
+	if got := term.String(); got != "\x1bPtmux;\x1b\x1b]52;c;bHM=\a\x1b\\" {
+		t.Fatalf("unexpected sequence %q", got)
+	}
+}
+
+func TestCopyToClipboard_NoTerminal(t *testing.T) {
+	stubClipboard(t, nil)
+	openTerminal = func() (io.WriteCloser, error) { return nil, errors.New("no terminal") }
+	if _, err := copyToClipboard(fakeSys{goos: "linux"}, "ls"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestQueryCopyKeepsStdoutClean(t *testing.T) {
+	_ = resetForTest(t)
+	t.Setenv("HOW_API_KEY", "test")
+	calls, term := stubClipboard(t, nil)
+	old := llmQuery
+	llmQuery = func(req LLMRequest) (LLMResponse, error) { return LLMResponse{Content: "ls -la"}, nil }
+	t.Cleanup(func() { llmQuery = old })
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetArgs([]string{"--copy", "list", "files"})
+	t.Cleanup(func() { rootCmd.SetOut(nil); rootCmd.SetArgs(nil) })
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "ls -la\n" {
+		t.Fatalf("stdout = %q", out.String())
+	}
+	if len(*calls) == 0 && !strings.Contains(term.String(), "]52;") {
+		t.Fatal("command was not copied")
+	}
+}
+
+func TestClipboardRun_DoesNotWaitForForkedChild(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("needs a POSIX shell")
+	}
+	// Like xclip, the tool leaves a child running that holds its stdout.
+	start := time.Now()
+	if err := clipboardRun(sh, []string{"-c", "cat >/dev/null; sleep 30 &"}, "ls"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Fatalf("clipboardRun waited %s for the background child", d)
+	}
+}
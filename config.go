@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+func configFilePath() (string, error) {
+	dir, err := howConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// readConfigFile returns the settings stored in config.yaml, ignoring
+// anything that only exists in memory (flags, environment, overrides).
+func readConfigFile() (map[string]any, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return nil, err
+	}
+	settings := map[string]any{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if settings == nil {
+		settings = map[string]any{}
+	}
+	return settings, nil
+}
+
+// updateConfig applies set and unset (dotted keys) to config.yaml, leaving
+// every other key untouched, and reloads it into viper. The file is
+// always written with 0600 permissions since it may hold credentials.
+func updateConfig(set map[string]any, unset ...string) error {
+	settings, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	for k, v := range set {
+		setNested(settings, k, v)
+	}
+	for _, k := range unset {
+		deleteNested(settings, k)
+	}
+
+	b, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+	if err := writePrivateFile(path, b); err != nil {
+		return err
+	}
+
+	return viper.ReadInConfig()
+}
+
+func setNested(m map[string]any, key string, v any) {
+	parts := strings.Split(strings.ToLower(key), ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			m[p] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = v
+}
+
+func deleteNested(m map[string]any, key string) {
+	parts := strings.Split(strings.ToLower(key), ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]any)
+		if !ok {
+			return
+		}
+		m = next
+	}
+	delete(m, parts[len(parts)-1])
+}
+
+// privateFiles may hold API keys, queries or commands and must only be
+// readable by their owner.
+var privateFiles = []string{"config.yaml", "history.jsonl", "secrets.json", "secret.key"}
+
+// warnLoosePermissions tells the user when dir or privateFiles can be read
+// by other users, which matters because they may contain API keys. Files
+// are created 0600 and tightened whenever how rewrites them; modes of files
+// it only reads are left to the user. A directory chosen with
+// HOW_CONFIG_DIR is not checked, only its files.
+func warnLoosePermissions(dir string) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var paths []string
+	if strings.TrimSpace(os.Getenv("HOW_CONFIG_DIR")) == "" {
+		paths = append(paths, dir)
+	}
+	for _, f := range privateFiles {
+		paths = append(paths, filepath.Join(dir, f))
+	}
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil || fi.Mode().Perm()&0077 == 0 {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "⚠️  %s is accessible by other users (mode %04o). Fix it with: chmod %o %q\n", p, fi.Mode().Perm(), fi.Mode().Perm()&^0077, p)
+	}
+}
+
+// writePrivateFile writes b to path readable by the owner only, also when
+// path already exists with a looser mode.
+func writePrivateFile(path string, b []byte) error {
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file; tighten it explicitly.
+	return os.Chmod(path, 0600)
+}
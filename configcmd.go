@@ -0,0 +1,429 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	typeString = "string"
+	typeBool   = "bool"
+	typeInt    = "int"
+	typeList   = "list"
+)
+
+type configKey struct {
+	Name    string
+	Type    string
+	Default any
+	Secret  bool
+	Allowed []string
+	Usage   string
+}
+
+// configSchema lists every setting `how` reads. Keys under profiles.<name>.
+// accept the subset named in profileKeys.
+var configSchema = []configKey{
+	{Name: "provider", Type: typeString, Allowed: knownProviders, Usage: "AI provider"},
+	{Name: "model", Type: typeString, Usage: "default model ID"},
+	{Name: "base_url", Type: typeString, Usage: "OpenAI-compatible API base URL"},
+	{Name: "api_key", Type: typeString, Secret: true, Usage: "plain-text API key"},
+	{Name: "api_key_ref", Type: typeString, Usage: "reference to the API key in a secret store"},
+	{Name: "api_key_cmd", Type: typeString, Usage: "command that prints the API key"},
+	{Name: "secret_backend", Type: typeString, Default: secretBackendAuto, Allowed: []string{secretBackendAuto, secretBackendKeyring, secretBackendFile, secretBackendConfig}, Usage: "where how setup stores API keys"},
+	{Name: "profile", Type: typeString, Usage: "profile used by default"},
+	{Name: "redact.enabled", Type: typeBool, Default: true, Usage: "redact secrets before sending queries"},
+	{Name: "redact.disable", Type: typeList, Usage: "built-in redaction detectors to turn off"},
+	{Name: "redact.patterns", Type: typeList, Usage: "extra regular expressions to redact"},
+	{Name: "shell", Type: typeString, Usage: "shell commands are generated for and run with (name or path)"},
+	{Name: "copy", Type: typeBool, Default: false, Usage: "always copy generated commands to the clipboard"},
+	{Name: "shell_history", Type: typeBool, Default: false, Usage: "append commands run with --run to the shell's history file"},
+	{Name: "structured_output", Type: typeString, Default: structuredAuto, Allowed: []string{structuredAuto, structuredOn, structuredOff}, Usage: "ask the model for a JSON reply with an explanation (auto: OpenAI and OpenRouter)"},
+	{Name: "prompt_template", Type: typeString, Usage: "path to a text/template file replacing the system prompt"},
+	{Name: "instructions", Type: typeString, Usage: "extra context added to the system prompt"},
+	{Name: "policy.rules", Type: typeList, Usage: "extra rules added to the system prompt"},
+	{Name: "policy.deny", Type: typeList, Usage: "regular expressions of commands --run refuses"},
+	{Name: "tools.detect", Type: typeBool, Default: true, Usage: "list installed CLI tools in the system prompt"},
+	{Name: "tools.versions", Type: typeBool, Default: true, Usage: "probe the versions of detected tools"},
+	{Name: "tools.cache_hours", Type: typeInt, Default: defaultToolsCacheHours, Usage: "how long the tool inventory is cached (0 disables)"},
+	{Name: "cache.enabled", Type: typeBool, Default: true, Usage: "reuse replies to repeated queries"},
+	{Name: "cache.ttl_hours", Type: typeInt, Default: defaultCacheTTLHours, Usage: "how long replies are reused (0 disables)"},
+	{Name: "suggest.enabled", Type: typeBool, Default: false, Usage: "offer similar commands from history before asking the model"},
+	{Name: "suggest.min_similarity", Type: typeInt, Default: defaultSuggestMinSimilarity, Usage: "how similar (0-100) a past query must be to be offered"},
+	{Name: "context.enabled", Type: typeBool, Default: false, Usage: "describe the current directory (git, project files) in the prompt"},
+	{Name: "context.max_files", Type: typeInt, Default: defaultContextMaxFiles, Usage: "most directory entries listed with context.enabled"},
+	{Name: "context.max_bytes", Type: typeInt, Default: defaultContextMaxBytes, Usage: "size limit of the directory description"},
+	{Name: "undo_max_mb", Type: typeInt, Default: defaultUndoMaxMB, Usage: "largest snapshot taken before --run"},
+}
+
+var (
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Get, set and list settings",
+		Long: "Get, set and list settings in config.yaml.\n\n" +
+			"Precedence: command-line flags > HOW_* environment variables (e.g. HOW_MODEL, HOW_REDACT_ENABLED) > config file > defaults.",
+	}
+
+	configGetCmd = &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print the effective value of a setting",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runConfigGet,
+	}
+
+	configSetCmd = &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Set a setting in config.yaml (lists are comma-separated)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runConfigSet,
+	}
+
+	configUnsetCmd = &cobra.Command{
+		Use:   "unset <key>",
+		Short: "Remove a setting from config.yaml",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runConfigUnset,
+	}
+
+	configListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List effective settings and where they come from (secrets are masked)",
+		Args:  cobra.NoArgs,
+		RunE:  runConfigList,
+	}
+
+	configPathCmd = &cobra.Command{
+		Use:   "path",
+		Short: "Print the path of config.yaml",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := configFilePath()
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), p)
+			return err
+		},
+	}
+
+	configEditCmd = &cobra.Command{
+		Use:   "edit",
+		Short: "Open config.yaml in $VISUAL or $EDITOR",
+		Args:  cobra.NoArgs,
+		RunE:  runConfigEdit,
+	}
+)
+
+// registerConfigDefaults wires defaults and HOW_* environment variables into
+// viper, giving flags > env > config file > defaults.
+func registerConfigDefaults() {
+	for _, k := range configSchema {
+		if k.Default != nil {
+			viper.SetDefault(k.Name, k.Default)
+		}
+	}
+	viper.SetEnvPrefix("how")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+}
+
+// configKeysHelp describes the known keys for `how config set --help`.
+func configKeysHelp() string {
+	var b strings.Builder
+	b.WriteString("Set a setting in config.yaml. Lists are comma-separated.\n\nKnown keys:\n")
+	for _, k := range configSchema {
+		fmt.Fprintf(&b, "  %-16s %-7s %s", k.Name, k.Type, k.Usage)
+		if len(k.Allowed) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(k.Allowed, ", "))
+		}
+		if k.Default != nil {
+			fmt.Fprintf(&b, " [default: %v]", k.Default)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "  profiles.<name>.{%s}\n", strings.Join(profileKeys, ","))
+	return b.String()
+}
+
+// effectiveConfigValue returns the value of key as `how` would use it,
+// including the --model flag, which outranks everything else.
+func effectiveConfigValue(key string) any {
+	if key == "model" && modelFlag != "" {
+		return modelFlag
+	}
+	return viper.Get(key)
+}
+
+func envName(key string) string {
+	return "HOW_" + strings.ToUpper(strings.NewReplacer(".", "_").Replace(key))
+}
+
+// lookupConfigKey returns the schema entry for key, including profile keys.
+func lookupConfigKey(key string) (configKey, error) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	name := key
+	if rest, ok := strings.CutPrefix(key, "profiles."); ok {
+		profile, sub, ok := strings.Cut(rest, ".")
+		if !ok || validateProfileName(profile) != nil || !contains(profileKeys, sub) {
+			return configKey{}, fmt.Errorf("unknown key %q (profile keys are profiles.<name>.{%s})", key, strings.Join(profileKeys, ","))
+		}
+		name = sub
+	}
+	for _, k := range configSchema {
+		if k.Name == name {
+			k.Name = key
+			return k, nil
+		}
+	}
+	var known []string
+	for _, k := range configSchema {
+		known = append(known, k.Name)
+	}
+	return configKey{}, fmt.Errorf("unknown key %q (known keys: %s)", key, strings.Join(known, ", "))
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseConfigValue converts raw to the key's type and checks allowed values.
+func parseConfigValue(k configKey, raw string) (any, error) {
+	switch k.Type {
+	case typeBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s expects true or false, got %q", k.Name, raw)
+		}
+		return b, nil
+	case typeInt:
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s expects a non-negative integer, got %q", k.Name, raw)
+		}
+		return n, nil
+	case typeList:
+		var items []string
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				items = append(items, v)
+			}
+		}
+		return items, nil
+	}
+	if len(k.Allowed) > 0 && !contains(k.Allowed, raw) {
+		return nil, fmt.Errorf("%s must be one of %s, got %q", k.Name, strings.Join(k.Allowed, ", "), raw)
+	}
+	return raw, nil
+}
+
+func formatConfigValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case []any, []string:
+		return strings.Join(viperStrings(t), ",")
+	}
+	return fmt.Sprint(v)
+}
+
+func viperStrings(v any) []string {
+	switch t := v.(type) {
+	case []string:
+		return t
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, e := range t {
+			out = append(out, fmt.Sprint(e))
+		}
+		return out
+	}
+	return nil
+}
+
+func maskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	if len(s) <= 8 {
+		return "****"
+	}
+	return "****" + s[len(s)-4:]
+}
+
+func runConfigGet(cmd *cobra.Command, args []string) error {
+	k, err := lookupConfigKey(args[0])
+	if err != nil {
+		return err
+	}
+	if err := applyProfile(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), formatConfigValue(effectiveConfigValue(k.Name)))
+	return err
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) error {
+	k, err := lookupConfigKey(args[0])
+	if err != nil {
+		return err
+	}
+	v, err := parseConfigValue(k, strings.TrimSpace(args[1]))
+	if err != nil {
+		return err
+	}
+	if err := updateConfig(map[string]any{k.Name: v}); err != nil {
+		return err
+	}
+	if k.Secret {
+		fmt.Fprintln(os.Stderr, "⚠️  Stored in plain text. 'how setup' keeps keys in the keyring or an encrypted file instead.")
+	}
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "✅ %s updated\n", k.Name)
+	return nil
+}
+
+func runConfigUnset(cmd *cobra.Command, args []string) error {
+	k, err := lookupConfigKey(args[0])
+	if err != nil {
+		return err
+	}
+	if err := updateConfig(nil, k.Name); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "✅ %s removed\n", k.Name)
+	return nil
+}
+
+func runConfigList(cmd *cobra.Command, args []string) error {
+	fileSettings, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	profile := activeProfile()
+	if err := applyProfile(); err != nil {
+		return err
+	}
+
+	var keys []configKey
+	keys = append(keys, configSchema...)
+	for _, name := range profileNames() {
+		for _, sub := range profileKeys {
+			k, _ := lookupConfigKey("profiles." + name + "." + sub)
+			keys = append(keys, k)
+		}
+	}
+
+	out := cmd.OutOrStdout()
+	for _, k := range keys {
+		var source string
+		switch {
+		case k.Name == "model" && modelFlag != "":
+			source = "flag --model"
+		case os.Getenv(envName(k.Name)) != "":
+			source = "env " + envName(k.Name)
+		case profile != "" && contains(profileKeys, k.Name):
+			source = "profile " + profile
+		case hasNested(fileSettings, k.Name):
+			source = "config"
+		case k.Default != nil:
+			source = "default"
+		default:
+			continue
+		}
+		value := formatConfigValue(effectiveConfigValue(k.Name))
+		if k.Secret {
+			value = maskSecret(value)
+		}
+		if value == "" && source == "profile "+profile {
+			continue
+		}
+		_, _ = fmt.Fprintf(out, "%s = %s  (%s)\n", k.Name, value, source)
+	}
+	return nil
+}
+
+func hasNested(m map[string]any, key string) bool {
+	parts := strings.Split(key, ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]any)
+		if !ok {
+			return false
+		}
+		m = next
+	}
+	_, ok := m[parts[len(parts)-1]]
+	return ok
+}
+
+func runConfigEdit(cmd *cobra.Command, args []string) error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			return err
+		}
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	// $EDITOR may carry arguments, e.g. "code --wait".
+	fields := strings.Fields(editor)
+	c := exec.Command(fields[0], append(fields[1:], path)...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var check map[string]any
+	if err := yaml.Unmarshal(b, &check); err != nil {
+		return fmt.Errorf("%s is not valid YAML: %w", path, err)
+	}
+	var unknown []string
+	collectUnknownKeys(check, "", &unknown)
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		fmt.Fprintf(os.Stderr, "⚠️  Unknown setting %q is ignored\n", k)
+	}
+	return nil
+}
+
+func collectUnknownKeys(m map[string]any, prefix string, unknown *[]string) {
+	for k, v := range m {
+		key := prefix + k
+		if _, err := lookupConfigKey(key); err == nil {
+			continue
+		}
+		if sub, ok := v.(map[string]any); ok {
+			collectUnknownKeys(sub, key+".", unknown)
+			continue
+		}
+		*unknown = append(*unknown, key)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfig_SetGetUnsetWithValidation(t *testing.T) {
+	cfgDir := resetForTest(t)
+
+	if _, err := executeRoot(t, "config", "set", "undo_max_mb", "25"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executeRoot(t, "config", "set", "redact.disable", "ip, email"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executeRoot(t, "config", "set", "undo_max_mb", "lots"); err == nil || !strings.Contains(err.Error(), "integer") {
+		t.Fatalf("expected type error, got: %v", err)
+	}
+	if _, err := executeRoot(t, "config", "set", "provider", "acme"); err == nil || !strings.Contains(err.Error(), "must be one of") {
+		t.Fatalf("expected allowed-values error, got: %v", err)
+	}
+	if _, err := executeRoot(t, "config", "set", "no_such_key", "x"); err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Fatalf("expected unknown key error, got: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(cfgDir, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsAll(string(b), []string{"undo_max_mb: 25", "- ip", "- email"}) {
+		t.Fatalf("unexpected config:\n%s", b)
+	}
+
+	if out, err := executeRoot(t, "config", "get", "redact.disable"); err != nil || strings.TrimSpace(out) != "ip,email" {
+		t.Fatalf("get: %q %v", out, err)
+	}
+
+	if _, err := executeRoot(t, "config", "unset", "undo_max_mb"); err != nil {
+		t.Fatal(err)
+	}
+	// Falls back to the default.
+	if out, _ := executeRoot(t, "config", "get", "undo_max_mb"); strings.TrimSpace(out) != "100" {
+		t.Fatalf("expected default after unset, got %q", out)
+	}
+}
+
+func TestConfig_ListMasksSecretsAndShowsPrecedence(t *testing.T) {
+	_ = resetForTest(t)
+
+	if _, err := executeRoot(t, "config", "set", "api_key", "sk-abcdefghijklmnop1234"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executeRoot(t, "config", "set", "model", "from-config"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOW_UNDO_MAX_MB", "7")
+
+	out, err := executeRoot(t, "config", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "sk-abcdefghijklmnop1234") || !strings.Contains(out, "api_key = ****1234  (config)") {
+		t.Fatalf("secret not masked:\n%s", out)
+	}
+	if !containsAll(out, []string{"model = from-config  (config)", "undo_max_mb = 7  (env HOW_UNDO_MAX_MB)", "redact.enabled = true  (default)"}) {
+		t.Fatalf("unexpected list:\n%s", out)
+	}
+
+	t.Setenv("HOW_MODEL", "from-env")
+	if out, _ := executeRoot(t, "config", "get", "model"); strings.TrimSpace(out) != "from-env" {
+		t.Fatalf("expected env to beat config, got %q", out)
+	}
+	modelFlag = "from-flag"
+	if out, _ := executeRoot(t, "config", "get", "model"); strings.TrimSpace(out) != "from-flag" {
+		t.Fatalf("expected flag to beat env, got %q", out)
+	}
+}
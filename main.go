@@ -3,7 +3,9 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +14,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -31,8 +34,9 @@ const (
 )
 
 type ChatRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
 }
 
 type Message struct {
@@ -42,6 +46,35 @@ type Message struct {
 
 type ChatResponse struct {
 	Choices []Choice `json:"choices"`
+	Usage   *Usage   `json:"usage,omitempty"`
+}
+
+// Usage is the token usage reported by the provider.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// LLMRequest is one query to a chat completions endpoint.
+type LLMRequest struct {
+	Endpoint      string
+	APIKey        string
+	SystemPrompt  string
+	Query         string
+	Model         string
+	RefererNeeded bool
+	// Structured asks for a JSON Reply instead of a bare command.
+	Structured bool
+}
+
+// LLMResponse is the model's reply, with token usage when the provider
+// reports it.
+type LLMResponse struct {
+	Content string
+	Usage   *Usage
+	// Structured is set when Content was requested as a JSON Reply.
+	Structured bool
 }
 
 type Choice struct {
@@ -55,6 +88,11 @@ type Sys interface {
 	GOOS() string
 	GOARCH() string
 	Stat(name string) (os.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	// Output runs a short-lived probe such as `git --version` and returns
+	// its combined output.
+	Output(name string, args ...string) ([]byte, error)
+	Getppid() int
 }
 
 type realSys struct{}
@@ -65,20 +103,42 @@ func (realSys) CurrentUser() (*user.User, error)      { return user.Current() }
 func (realSys) GOOS() string                          { return runtime.GOOS }
 func (realSys) GOARCH() string                        { return runtime.GOARCH }
 func (realSys) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+func (realSys) ReadFile(name string) ([]byte, error)  { return os.ReadFile(name) }
+func (realSys) Getppid() int                          { return os.Getppid() }
+func (realSys) Output(name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
 
 var defaultSys Sys = realSys{}
 
 var llmQuery = queryLLM
 
 type HistoryEntry struct {
+	ID        string    `json:"id,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
 	Query     string    `json:"query"`
-	Command   string    `json:"command"`
-	Provider  string    `json:"provider"`
-	Model     string    `json:"model"`
-	OS        string    `json:"os"`
-	Arch      string    `json:"arch"`
-	Shell     string    `json:"shell"`
+	// Type is "answer" for direct answers and "refusal" when the model
+	// declined, with the text kept in Explanation, and "script" for
+	// --script; empty means a command.
+	Type        string `json:"type,omitempty"`
+	Command     string `json:"command"`
+	Redacted    bool   `json:"redacted,omitempty"`
+	Profile     string `json:"profile,omitempty"`
+	Provider    string `json:"provider"`
+	Model       string `json:"model"`
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	Shell       string `json:"shell"`
+	Explanation string `json:"explanation,omitempty"`
+	// Alternatives holds every command offered with -n; Choice is the
+	// 1-based index of the one picked.
+	Alternatives []string `json:"alternatives,omitempty"`
+	Choice       int      `json:"choice,omitempty"`
+	// ReusedFrom is the ID of the entry whose command was reused instead
+	// of asking the model; Provider and Model are copied from it.
+	ReusedFrom string `json:"reused_from,omitempty"`
 }
 
 var (
@@ -98,25 +158,30 @@ var (
 	setupCmd = &cobra.Command{
 		Use:   "setup",
 		Short: "Configure provider and API key",
-		Run:   runSetup,
+		Long: "Configure provider and API key interactively, or non-interactively with flags:\n\n" +
+			"  echo \"$KEY\" | how setup --provider openai --api-key-stdin --model gpt-4o",
+		Args: cobra.NoArgs,
+		RunE: runSetup,
 	}
 
 	setModelCmd = &cobra.Command{
 		Use:   "set-model <model>",
 		Short: "Set and persist the default model",
 		Args:  cobra.ExactArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			m := strings.TrimSpace(args[0])
 			if m == "" {
-				fmt.Fprintln(os.Stderr, "Model cannot be empty.")
-				os.Exit(1)
+				return withExitCode(exitUsage, fmt.Errorf("model cannot be empty"))
+			}
+			profile, err := existingProfile()
+			if err != nil {
+				return err
 			}
-			viper.Set("model", m)
-			if err := saveConfig(); err != nil {
-				fmt.Fprintf(os.Stderr, "Error saving config: %v\n", err)
-				os.Exit(1)
+			if err := updateConfig(map[string]any{profileKey(profile, "model"): m}); err != nil {
+				return fmt.Errorf("failed to save config: %w", err)
 			}
 			fmt.Println("✅ Default model saved successfully!")
+			return nil
 		},
 	}
 
@@ -124,19 +189,58 @@ var (
 		Use:   "last",
 		Short: "Print (or run) the last generated command",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateFormat(); err != nil {
+				return err
+			}
+			if runFlag && jsonOutput() {
+				return withExitCode(exitUsage, fmt.Errorf("--run cannot be combined with --format json"))
+			}
 			entry, err := readLastHistory()
 			if err != nil {
 				return err
 			}
+			if entry.Type == replyRefusal {
+				return withExitCode(exitRefused, fmt.Errorf("the model declined: %s", entry.Explanation))
+			}
+			if entry.Type == replyAnswer {
+				if runFlag {
+					return withExitCode(exitRefused, fmt.Errorf("the last reply was an answer, not a command; nothing to run"))
+				}
+				if jsonOutput() {
+					return writeJSON(cmd.OutOrStdout(), JSONResult{Type: replyAnswer, Explanation: entry.Explanation, Risk: riskLow, Provider: entry.Provider, Model: entry.Model, HistoryID: entry.ID})
+				}
+				return printAnswer(cmd.OutOrStdout(), entry.Explanation)
+			}
 
 			// Keep stdout clean: print the raw command to stdout
-			_, _ = fmt.Fprintln(cmd.OutOrStdout(), entry.Command)
+			if err := printResult(cmd.OutOrStdout(), entry.Command, JSONResult{
+				Type:        entry.Type,
+				Explanation: entry.Explanation,
+				Provider:    entry.Provider,
+				Model:       entry.Model,
+				HistoryID:   entry.ID,
+			}); err != nil {
+				return err
+			}
+			copyCommand(entry.Command)
 
 			if runFlag {
+				if entry.Redacted {
+					return withExitCode(exitRefused, fmt.Errorf("last command contains redacted values and cannot be run; re-run the query instead"))
+				}
+				if err := applyProjectConfig(); err != nil {
+					return withExitCode(exitConfig, err)
+				}
+				if entry.Type == replyScript {
+					return runScript(entry.Command, *entry)
+				}
+				if err := checkPolicy(entry.Command); err != nil {
+					return withExitCode(exitRefused, err)
+				}
 				if err := confirmOrFail(entry.Command); err != nil {
-					return err
+					return withExitCode(exitRefused, err)
 				}
-				return executeShellCommand(entry.Command)
+				return executeWithSnapshot(entry.Command, *entry)
 			}
 			return nil
 		},
@@ -146,20 +250,52 @@ var (
 func init() {
 	initConfig()
 
+	// main prints errors, in the format chosen with --format.
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
+	rootCmd.SetFlagErrorFunc(flagError)
+
 	rootCmd.PersistentFlags().StringVar(&modelFlag, "model", "", "Override configured model")
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Print debug information")
 	rootCmd.PersistentFlags().BoolVar(&runFlag, "run", false, "Execute the generated command (asks for confirmation unless --yes)")
 	rootCmd.PersistentFlags().BoolVar(&yesFlag, "yes", false, "Skip confirmation prompt when using --run")
-
+	rootCmd.PersistentFlags().IntVarP(&candidatesFlag, "candidates", "n", 1, fmt.Sprintf("Offer this many alternative commands to choose from (max %d)", maxCandidates))
+	rootCmd.PersistentFlags().StringVar(&formatFlag, "format", formatText, "Output format: text or json")
+	rootCmd.PersistentFlags().BoolVar(&scriptFlag, "script", false, "Generate a multi-line script instead of a single command")
+	rootCmd.PersistentFlags().BoolVar(&noCacheFlag, "no-cache", false, "Do not read or write the response cache")
+	rootCmd.PersistentFlags().BoolVar(&refreshFlag, "refresh", false, "Ask the model again and update the response cache")
+	rootCmd.PersistentFlags().BoolVar(&copyFlag, "copy", false, "Also copy the generated command to the clipboard")
+	rootCmd.PersistentFlags().BoolVar(&noContextFlag, "no-context", false, "Do not describe the current directory in the prompt")
+	rootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "", "Use a named profile (overrides HOW_PROFILE and the configured profile)")
+
+	addSetupFlags(setupCmd)
 	rootCmd.AddCommand(setupCmd)
 	rootCmd.AddCommand(setModelCmd)
 	rootCmd.AddCommand(lastCmd)
+
+	undoCmd.Flags().BoolVar(&undoListFlag, "list", false, "List available snapshots")
+	rootCmd.AddCommand(undoCmd)
+
+	addSetupFlags(profileAddCmd)
+	profileCmd.AddCommand(profileAddCmd, profileListCmd, profileUseCmd, profileRemoveCmd)
+	rootCmd.AddCommand(profileCmd)
+
+	configSetCmd.Long = configKeysHelp()
+	configCmd.AddCommand(configGetCmd, configSetCmd, configUnsetCmd, configListCmd, configPathCmd, configEditCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(trustCmd)
+
+	promptCmd.AddCommand(promptShowCmd, promptTemplateCmd)
+	rootCmd.AddCommand(promptCmd)
+	rootCmd.AddCommand(initCmd)
+
+	usageArgs(rootCmd)
 }
 
 func howConfigDir() (string, error) {
 	// Test/CI override (and generally useful for power users)
 	if d := strings.TrimSpace(os.Getenv("HOW_CONFIG_DIR")); d != "" {
-		if err := os.MkdirAll(d, 0755); err != nil {
+		if err := os.MkdirAll(d, 0700); err != nil {
 			return "", err
 		}
 		return d, nil
@@ -170,7 +306,7 @@ func howConfigDir() (string, error) {
 		return "", err
 	}
 	d := filepath.Join(configDir, "how")
-	if err := os.MkdirAll(d, 0755); err != nil {
+	if err := os.MkdirAll(d, 0700); err != nil {
 		return "", err
 	}
 	return d, nil
@@ -179,6 +315,7 @@ func howConfigDir() (string, error) {
 func initConfig() {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
+	registerConfigDefaults()
 
 	dir, err := howConfigDir()
 	if err != nil {
@@ -187,15 +324,7 @@ func initConfig() {
 
 	viper.AddConfigPath(dir)
 	_ = viper.ReadInConfig()
-}
-
-func saveConfig() error {
-	dir, err := howConfigDir()
-	if err != nil {
-		return err
-	}
-	configPath := filepath.Join(dir, "config.yaml")
-	return viper.WriteConfigAs(configPath)
+	warnLoosePermissions(dir)
 }
 
 func historyFilePath() (string, error) {
@@ -211,11 +340,13 @@ func appendHistory(e HistoryEntry) {
 	if err != nil {
 		return
 	}
-	f, err := os.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
 	if err != nil {
 		return
 	}
 	defer func() { _ = f.Close() }()
+	// The history of older versions may be readable by others.
+	_ = f.Chmod(0600)
 
 	b, err := json.Marshal(e)
 	if err != nil {
@@ -257,78 +388,198 @@ func readLastHistory() (*HistoryEntry, error) {
 	if err := json.Unmarshal([]byte(lastLine), &e); err != nil {
 		return nil, fmt.Errorf("failed to parse history: %w", err)
 	}
-	if strings.TrimSpace(e.Command) == "" {
+	if e.Type == replyAnswer || e.Type == replyRefusal {
+		if strings.TrimSpace(e.Explanation) == "" {
+			return nil, fmt.Errorf("last history entry has empty answer")
+		}
+	} else if strings.TrimSpace(e.Command) == "" {
 		return nil, fmt.Errorf("last history entry has empty command")
 	}
 	return &e, nil
 }
 
-func runSetup(cmd *cobra.Command, args []string) {
-	reader := bufio.NewReader(os.Stdin)
-
-	fmt.Println("Select AI Provider:")
-	fmt.Println("1. OpenRouter (default)")
-	fmt.Println("2. OpenAI")
-	fmt.Print("Choice [1]: ")
-
-	choice, _ := reader.ReadString('\n')
-	choice = strings.TrimSpace(choice)
-
-	provider := providerOpenRouter
-	if choice == "2" {
-		provider = providerOpenAI
+func runQuery(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return cmd.Help()
 	}
-
-	fmt.Printf("\nEnter your %s API key: ", provider)
-	apiKey, _ := reader.ReadString('\n')
-	apiKey = strings.TrimSpace(apiKey)
-
-	if apiKey == "" {
-		fmt.Fprintln(os.Stderr, "API key cannot be empty.")
-		os.Exit(1)
+	if err := validateFormat(); err != nil {
+		return err
+	}
+	if err := validateCandidates(candidatesFlag); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if runFlag && jsonOutput() {
+		return withExitCode(exitUsage, fmt.Errorf("--run cannot be combined with --format json"))
+	}
+	if scriptFlag && candidatesFlag > 1 {
+		return withExitCode(exitUsage, fmt.Errorf("--script cannot be combined with -n"))
 	}
 
-	viper.Set("provider", provider)
-	viper.Set("api_key", apiKey)
+	if err := applyProfile(); err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	if err := applyProjectConfig(); err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	profile := activeProfile()
 
-	// Clear model on provider switch to avoid invalid model IDs for the new provider
-	viper.Set("model", "")
+	query := strings.Join(args, " ")
 
-	if err := saveConfig(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error saving config: %v\n", err)
-		os.Exit(1)
+	redactor, err := newRedactorFromConfig()
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	safeQuery, redactions := redactor.Redact(query)
+
+	var resp LLMResponse
+	var cache *pendingCache
+	var reply Reply
+	var provider, effectiveModel, reusedFrom string
+	// A reused command needs neither an API key nor a system prompt, and
+	// keeps the provider and model that generated it.
+	if prev := suggestFromHistory(safeQuery); prev != nil {
+		reply = Reply{Type: replyCommand, Command: prev.Command, Explanation: prev.Explanation}
+		provider, effectiveModel, reusedFrom = prev.Provider, prev.Model, prev.ID
+	} else {
+		provider = viper.GetString("provider")
+		if provider == "" {
+			provider = providerOpenRouter
+		}
+		if resp, effectiveModel, cache, err = askModel(provider, profile, safeQuery, redactions.Count()); err != nil {
+			return err
+		}
+		if reply, err = replyFromResponse(resp); err != nil {
+			return withExitCode(exitProvider, err)
+		}
 	}
+	entry := HistoryEntry{
+		ID:         newID(),
+		Timestamp:  time.Now(),
+		Query:      safeQuery,
+		Redacted:   redactions.Count() > 0,
+		Profile:    profile,
+		Provider:   provider,
+		Model:      effectiveModel,
+		ReusedFrom: reusedFrom,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Shell:      resolveShell(defaultSys).Name,
+	}
+	switch reply.Type {
+	case replyRefusal:
+		entry.Type = replyRefusal
+		entry.Explanation = reply.Explanation
+		appendHistory(entry)
+		return withExitCode(exitRefused, fmt.Errorf("the model declined: %s", redactions.Restore(reply.Explanation)))
+	case replyAnswer:
+		entry.Type = replyAnswer
+		entry.Explanation = reply.Explanation
+		appendHistory(entry)
+		cache.store()
+
+		answer := redactions.Restore(reply.Explanation)
+		if jsonOutput() {
+			return writeJSON(cmd.OutOrStdout(), JSONResult{Type: replyAnswer, Explanation: answer, Risk: riskLow, Provider: provider, Model: effectiveModel, Usage: resp.Usage, HistoryID: entry.ID})
+		}
+		if err := printAnswer(cmd.OutOrStdout(), answer); err != nil {
+			return err
+		}
+		if runFlag {
+			fmt.Fprintln(os.Stderr, "Nothing to run: the model answered instead of giving a command.")
+		}
+		return nil
+	}
+	safeCommand := reply.Command
+	explanation := reply.Explanation
+	var alternatives []string
+	choice := 0
+	if candidatesFlag > 1 {
+		candidates, err := parseCandidates(safeCommand, candidatesFlag)
+		if err != nil {
+			return withExitCode(exitProvider, err)
+		}
+		if choice, err = pickCandidate(candidates, redactions); err != nil {
+			return withExitCode(exitRefused, err)
+		}
+		for _, c := range candidates {
+			alternatives = append(alternatives, c.Command)
+		}
+		safeCommand = candidates[choice].Command
+		explanation = candidates[choice].Description
+		choice++
+	}
+	safeCommand = strings.TrimSpace(safeCommand)
+	if safeCommand == "" {
+		return withExitCode(exitProvider, fmt.Errorf("model returned an empty command"))
+	}
+	// Guardrail: you requested single-line; refuse multi-line before execution.
+	if !scriptFlag && (strings.Contains(safeCommand, "\n") || strings.Contains(safeCommand, "\r")) {
+		return withExitCode(exitProvider, fmt.Errorf("model returned a multi-line response; refusing"))
+	}
+	command := redactions.Restore(safeCommand)
 
-	fmt.Println("✅ Configuration saved successfully!")
-}
-
-func runQuery(cmd *cobra.Command, args []string) error {
-	if len(args) == 0 {
-		return cmd.Help()
+	// Save history (best-effort). Only the redacted form is written to disk.
+	entry.Command = safeCommand
+	if scriptFlag {
+		entry.Type = replyScript
 	}
+	entry.Explanation = explanation
+	entry.Alternatives = alternatives
+	entry.Choice = choice
+	appendHistory(entry)
+	cache.store()
 
-	apiKey := viper.GetString("api_key")
-	if apiKey == "" {
-		return fmt.Errorf("API key not found. Please run 'how setup'")
+	// Always print the raw command to stdout (preserves existing behavior)
+	err = printResult(cmd.OutOrStdout(), command, JSONResult{
+		Type:        entry.Type,
+		Explanation: redactions.Restore(explanation),
+		Risk:        reply.risk(),
+		Provider:    provider,
+		Model:       effectiveModel,
+		Usage:       resp.Usage,
+		HistoryID:   entry.ID,
+	})
+	if err != nil {
+		return err
+	}
+	if explanation != "" && !jsonOutput() && isTTY(os.Stdout) && isTTY(os.Stderr) {
+		fmt.Fprintf(os.Stderr, "# %s\n", redactions.Restore(explanation))
 	}
+	copyCommand(command)
 
-	provider := viper.GetString("provider")
-	if provider == "" {
-		provider = providerOpenRouter
+	if runFlag && scriptFlag {
+		return runScript(command, entry)
+	}
+	if runFlag {
+		if err := checkPolicy(command); err != nil {
+			return withExitCode(exitRefused, err)
+		}
+		if reply.Destructive {
+			fmt.Fprintln(os.Stderr, "⚠️  The model marked this command as destructive.")
+		}
+		if err := confirmOrFail(command); err != nil {
+			return withExitCode(exitRefused, err)
+		}
+		return executeWithSnapshot(command, entry)
 	}
 
-	var endpoint, defaultModel string
-	isRefererNeeded := false
+	return nil
+}
 
-	switch provider {
-	case providerOpenAI:
-		endpoint = openAiURL
-		defaultModel = openAiDefaultModel
-	default:
-		endpoint = openRouterURL
-		defaultModel = openRouterDefaultModel
-		isRefererNeeded = true
+// askModel sends the redacted query to provider and returns its response,
+// the model that was used and the pending cache write for a fresh reply.
+// redacted is only reported with --debug.
+func askModel(provider, profile, safeQuery string, redacted int) (LLMResponse, string, *pendingCache, error) {
+	apiKey, keySource, err := resolveAPIKey(provider)
+	if err != nil {
+		return LLMResponse{}, "", nil, withExitCode(exitConfig, err)
 	}
+	// Local OpenAI-compatible servers configured via base_url often need no key.
+	if apiKey == "" && viper.GetString("base_url") == "" {
+		return LLMResponse{}, "", nil, withExitCode(exitConfig, fmt.Errorf("API key not found. Please run 'how setup' or set HOW_API_KEY"))
+	}
+
+	endpoint, defaultModel, isRefererNeeded := providerEndpoint(provider, viper.GetString("base_url"))
 
 	effectiveModel := defaultModel
 	if m := viper.GetString("model"); m != "" {
@@ -338,80 +589,117 @@ func runQuery(cmd *cobra.Command, args []string) error {
 		effectiveModel = modelFlag
 	}
 
-	query := strings.Join(args, " ")
+	systemPrompt, err := buildSystemPrompt()
+	if err != nil {
+		return LLMResponse{}, "", nil, withExitCode(exitConfig, err)
+	}
 
 	if debug {
 		fmt.Fprintln(os.Stderr, "=== DEBUG INFO ===")
+		fmt.Fprintf(os.Stderr, "Profile: %s\n", profileLabel(profile))
+		if projectConfigPath != "" {
+			fmt.Fprintf(os.Stderr, "Project config: %s\n", projectConfigPath)
+		}
 		fmt.Fprintf(os.Stderr, "Provider: %s\n", provider)
 		fmt.Fprintf(os.Stderr, "Endpoint: %s\n", endpoint)
 		fmt.Fprintf(os.Stderr, "Model: %s\n", effectiveModel)
-		fmt.Fprintln(os.Stderr, "System Prompt:\n", buildSystemPrompt())
+		fmt.Fprintf(os.Stderr, "API key source: %s\n", keySource)
+		sh := resolveShell(defaultSys)
+		fmt.Fprintf(os.Stderr, "Shell: %s (%s)\n", sh.Name, sh.Path)
+		fmt.Fprintf(os.Stderr, "Redacted values: %d\n", redacted)
+		fmt.Fprintln(os.Stderr, "System Prompt:\n", systemPrompt)
 		fmt.Fprintln(os.Stderr, "=== END DEBUG INFO ===")
 	}
 
-	command, err := llmQuery(endpoint, apiKey, query, effectiveModel, isRefererNeeded)
-	if err != nil {
-		return err
-	}
-	command = strings.TrimSpace(command)
-	if command == "" {
-		return fmt.Errorf("model returned an empty command")
-	}
-	// Guardrail: you requested single-line; refuse multi-line before execution.
-	if strings.Contains(command, "\n") || strings.Contains(command, "\r") {
-		return fmt.Errorf("model returned a multi-line response; refusing")
-	}
-
-	// Save history (best-effort)
-	appendHistory(HistoryEntry{
-		Timestamp: time.Now(),
-		Query:     query,
-		Command:   command,
-		Provider:  provider,
-		Model:     effectiveModel,
-		OS:        runtime.GOOS,
-		Arch:      runtime.GOARCH,
-		Shell:     detectShellName(defaultSys),
+	resp, cache, err := cachedQuery(provider, LLMRequest{
+		Endpoint:      endpoint,
+		APIKey:        apiKey,
+		SystemPrompt:  systemPrompt,
+		Query:         safeQuery,
+		Model:         effectiveModel,
+		RefererNeeded: isRefererNeeded,
+		// -n and --script rely on the plain-text format.
+		Structured: candidatesFlag == 1 && !scriptFlag && useStructuredOutput(provider),
 	})
-
-	// Always print the raw command to stdout (preserves existing behavior)
-	_, err = fmt.Fprintln(cmd.OutOrStdout(), command)
 	if err != nil {
-		return err
+		return LLMResponse{}, "", nil, withExitCode(exitProvider, err)
 	}
+	return resp, effectiveModel, cache, nil
+}
 
-	if runFlag {
-		if err := confirmOrFail(command); err != nil {
-			return err
+// replyFromResponse reads the model's reply: a structured Reply when one
+// was requested and returned, otherwise the plain text cleaned up for the
+// current mode, with direct answers told apart from commands.
+func replyFromResponse(resp LLMResponse) (Reply, error) {
+	reply := Reply{Type: replyCommand, Command: resp.Content}
+	if resp.Structured {
+		// Models may still answer in plain text; that is read as before.
+		// JSON that does not decode to a reply is never taken for a command.
+		r, ok := parseReply(resp.Content)
+		switch {
+		case ok:
+			reply = r
+		case looksLikeJSON(resp.Content):
+			return Reply{}, errors.New("the model returned a malformed reply")
 		}
-		return executeShellCommand(command)
 	}
+	switch {
+	case scriptFlag:
+		reply.Command = parseScript(reply.Command)
+	case candidatesFlag == 1:
+		reply.Command = normalizeResponse(reply.Command)
+	}
+	if !scriptFlag && reply.Type == replyCommand && candidatesFlag == 1 && looksLikeAnswer(defaultSys, reply.Command) {
+		reply = Reply{Type: replyAnswer, Explanation: strings.TrimSpace(reply.Command)}
+	}
+	return reply, nil
+}
 
-	return nil
+// providerEndpoint returns the chat completions endpoint and default model
+// for provider. A non-empty baseURL (any OpenAI-compatible API, e.g. a local
+// model server) replaces the provider's own endpoint.
+func providerEndpoint(provider, baseURL string) (endpoint, defaultModel string, refererNeeded bool) {
+	switch provider {
+	case providerOpenAI:
+		endpoint = openAiURL
+		defaultModel = openAiDefaultModel
+	default:
+		endpoint = openRouterURL
+		defaultModel = openRouterDefaultModel
+		refererNeeded = true
+	}
+	if baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/"); baseURL != "" {
+		endpoint = baseURL + "/chat/completions"
+	}
+	return endpoint, defaultModel, refererNeeded
 }
 
-func queryLLM(endpoint, apiKey, query, model string, refererNeeded bool) (string, error) {
+func queryLLM(r LLMRequest) (LLMResponse, error) {
 	reqBody := ChatRequest{
-		Model: model,
+		Model: r.Model,
 		Messages: []Message{
-			{Role: "system", Content: buildSystemPrompt()},
-			{Role: "user", Content: query},
+			{Role: "system", Content: r.SystemPrompt},
+			{Role: "user", Content: r.Query},
 		},
 	}
+	if r.Structured {
+		reqBody.Messages[0].Content += structuredInstruction
+		reqBody.ResponseFormat = replyResponseFormat
+	}
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", err
+		return LLMResponse{}, err
 	}
 
-	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", r.Endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", err
+		return LLMResponse{}, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	if refererNeeded {
+	req.Header.Set("Authorization", "Bearer "+r.APIKey)
+	if r.RefererNeeded {
 		req.Header.Set("HTTP-Referer", "https://github.com/patrykgruszka/how-cli")
 		req.Header.Set("X-Title", "how-cli")
 	}
@@ -419,29 +707,42 @@ func queryLLM(endpoint, apiKey, query, model string, refererNeeded bool) (string
 	client := &http.Client{Timeout: 20 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return LLMResponse{}, err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return LLMResponse{}, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+		// Models without JSON schema support reject response_format; ask
+		// again the plain-text way.
+		if r.Structured && (resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity) {
+			if debug {
+				fmt.Fprintf(os.Stderr, "Structured output rejected (%d), retrying as plain text\n", resp.StatusCode)
+			}
+			r.Structured = false
+			return queryLLM(r)
+		}
+		return LLMResponse{}, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
 	}
 
 	var apiResp ChatResponse
 	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return "", err
+		return LLMResponse{}, err
 	}
 
 	if len(apiResp.Choices) == 0 {
-		return "", fmt.Errorf("empty response from API")
+		return LLMResponse{}, fmt.Errorf("empty response from API")
 	}
 
-	return strings.TrimSpace(apiResp.Choices[0].Message.Content), nil
+	return LLMResponse{
+		Content:    strings.TrimSpace(apiResp.Choices[0].Message.Content),
+		Usage:      apiResp.Usage,
+		Structured: r.Structured,
+	}, nil
 }
 
 func isTTY(f *os.File) bool {
@@ -453,17 +754,23 @@ func isTTY(f *os.File) bool {
 }
 
 func confirmOrFail(command string) error {
+	return confirm("Run this command?", command)
+}
+
+// confirm asks a yes/no question on the terminal, showing detail below it.
+// --yes answers it; without a TTY it fails safe.
+func confirm(question, detail string) error {
 	if yesFlag {
 		return nil
 	}
 	// If we cannot prompt, fail safe.
 	if !isTTY(os.Stdin) || !isTTY(os.Stderr) {
-		return fmt.Errorf("refusing to run without confirmation (no TTY). Re-run with --yes if you really want to")
+		return fmt.Errorf("refusing to continue without confirmation (no TTY). Re-run with --yes if you really want to")
 	}
 
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Fprintln(os.Stderr, "Run this command? [y/N]")
-	fmt.Fprintln(os.Stderr, command)
+	fmt.Fprintf(os.Stderr, "%s [y/N]\n", question)
+	fmt.Fprintln(os.Stderr, detail)
 	fmt.Fprint(os.Stderr, "> ")
 
 	in, _ := reader.ReadString('\n')
@@ -474,102 +781,171 @@ func confirmOrFail(command string) error {
 	return fmt.Errorf("aborted")
 }
 
-func detectShellName(sys Sys) string {
-	if sys.GOOS() == "windows" {
-		if _, err := sys.LookPath("pwsh"); err == nil {
-			return "pwsh"
-		}
-		if _, err := sys.LookPath("powershell"); err == nil {
-			return "powershell"
-		}
-		return "cmd"
-	}
-	if shell := sys.Env("SHELL"); shell != "" {
-		return filepath.Base(shell)
-	}
-	return "sh"
-}
-
 func executeShellCommand(command string) error {
-	if runtime.GOOS == "windows" {
-		if _, err := exec.LookPath("pwsh"); err == nil {
-			c := exec.Command("pwsh", "-NoProfile", "-Command", command)
-			c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
-			return c.Run()
+	shell := resolveShell(defaultSys)
+	if viper.GetBool("shell_history") {
+		if err := appendShellHistory(defaultSys, shell, command, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Not added to your shell history: %v\n", err)
 		}
-		if _, err := exec.LookPath("powershell"); err == nil {
-			c := exec.Command("powershell", "-NoProfile", "-Command", command)
-			c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
-			return c.Run()
-		}
-		c := exec.Command("cmd", "/C", command)
-		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
-		return c.Run()
 	}
+	return shellCommand(shell, command).Run()
+}
 
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "sh"
-	}
-	c := exec.Command(shell, "-c", command)
-	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
-	return c.Run()
+// SystemInfo describes the machine the generated command will run on.
+type SystemInfo struct {
+	OS                    string
+	Distro                string
+	DistroID              string
+	DistroLike            []string
+	Kernel                string
+	Container             string
+	WSL                   string
+	Arch                  string
+	Shell                 string
+	PackageManagers       []string
+	PrimaryPackageManager string
+	Privileges            string
+	Userland              []string
+	Tools                 []Tool
+	MissingTools          []string
 }
 
-func getSystemInfo() string { return getSystemInfoWith(defaultSys) }
+func getSystemInfoWith(sys Sys) string { return collectSystemInfo(sys).String() }
 
-func getSystemInfoWith(sys Sys) string {
-	var info []string
+func collectSystemInfo(sys Sys) SystemInfo {
+	var info SystemInfo
 
-	osName := sys.GOOS()
-	switch osName {
+	info.OS = sys.GOOS()
+	switch info.OS {
 	case "linux":
-		osName = "Linux"
+		info.OS = "Linux"
 	case "darwin":
-		osName = "macOS"
+		info.OS = "macOS"
 	case "windows":
-		osName = "Windows"
-	}
-	info = append(info, fmt.Sprintf("- OS: %s", osName))
-	info = append(info, fmt.Sprintf("- Architecture: %s", sys.GOARCH()))
-
-	if shell := sys.Env("SHELL"); shell != "" {
-		info = append(info, fmt.Sprintf("- Shell: %s", filepath.Base(shell)))
-	} else if sys.GOOS() == "windows" {
-		if _, err := sys.LookPath("pwsh"); err == nil {
-			info = append(info, "- Shell: PowerShell Core")
-		} else if _, err := sys.LookPath("powershell"); err == nil {
-			info = append(info, "- Shell: Windows PowerShell")
-		} else {
-			info = append(info, "- Shell: Command Prompt")
-		}
+		info.OS = "Windows"
 	}
+	info.Arch = sys.GOARCH()
 
-	if managers := detectPackageManagersWith(sys); len(managers) > 0 {
-		info = append(info, fmt.Sprintf("- Package Managers: %s", strings.Join(managers, ", ")))
+	if sys.GOOS() == "linux" {
+		detectLinuxEnvironment(sys, &info)
 	}
 
-	if priv := detectUserPrivilegesWith(sys); priv != "" {
-		info = append(info, fmt.Sprintf("- User Privileges: %s", priv))
-	}
+	info.Shell = shellLabel(resolveShell(sys).Name)
+
+	info.PackageManagers, info.PrimaryPackageManager = detectPackageManagersWith(sys, append([]string{info.DistroID}, info.DistroLike...))
+	info.Privileges = detectUserPrivilegesWith(sys)
+	return info
+}
 
+// String renders the info as the bullet list used in the system prompt.
+func (s SystemInfo) String() string {
+	var info []string
+	info = append(info, fmt.Sprintf("- OS: %s", s.OS))
+	if s.Distro != "" {
+		info = append(info, fmt.Sprintf("- Distribution: %s", s.Distro))
+	}
+	if s.Kernel != "" {
+		info = append(info, fmt.Sprintf("- Kernel: %s", s.Kernel))
+	}
+	info = append(info, fmt.Sprintf("- Architecture: %s", s.Arch))
+	if s.WSL != "" {
+		info = append(info, fmt.Sprintf("- WSL: %s (Windows host; Windows drives under /mnt)", s.WSL))
+	}
+	if s.Container != "" {
+		info = append(info, fmt.Sprintf("- Container: %s", s.Container))
+	}
+	if s.Shell != "" {
+		info = append(info, fmt.Sprintf("- Shell: %s", s.Shell))
+	}
+	if len(s.PackageManagers) > 0 {
+		info = append(info, fmt.Sprintf("- Package Managers: %s", strings.Join(s.PackageManagers, ", ")))
+	}
+	if s.PrimaryPackageManager != "" {
+		info = append(info, fmt.Sprintf("- Primary Package Manager: %s", s.PrimaryPackageManager))
+	}
+	if s.Privileges != "" {
+		info = append(info, fmt.Sprintf("- User Privileges: %s", s.Privileges))
+	}
+	if len(s.Userland) > 0 {
+		info = append(info, fmt.Sprintf("- Userland: %s", strings.Join(s.Userland, ", ")))
+	}
+	if len(s.Tools) > 0 {
+		var tools []string
+		for _, t := range s.Tools {
+			tools = append(tools, t.String())
+		}
+		info = append(info, fmt.Sprintf("- Installed Tools: %s", strings.Join(tools, ", ")))
+	}
+	if len(s.MissingTools) > 0 {
+		info = append(info, fmt.Sprintf("- Not Installed: %s", strings.Join(s.MissingTools, ", ")))
+	}
 	return strings.Join(info, "\n")
 }
 
-func detectPackageManagersWith(sys Sys) []string {
-	var managers []string
-	pmMap := map[string]string{
-		"pacman": "pacman (Arch)", "apt": "apt (Debian)", "dnf": "dnf (Fedora)",
-		"yum": "yum (RHEL)", "zypper": "zypper (openSUSE)", "brew": "Homebrew",
-		"port": "MacPorts", "winget": "winget", "choco": "Chocolatey",
-		"scoop": "Scoop", "snap": "Snap", "flatpak": "Flatpak", "nix": "Nix",
-	}
-	for cmd, name := range pmMap {
-		if _, err := sys.LookPath(cmd); err == nil {
-			managers = append(managers, name)
+// packageManager is a package manager the detector knows about. Native
+// lists the GOOS values or os-release IDs it is the standard manager for;
+// Universal marks cross-distro managers that are never primary.
+type packageManager struct {
+	Cmd       string
+	Name      string
+	Native    []string
+	Universal bool
+}
+
+// packageManagers is in order of preference among equally ranked managers.
+var packageManagers = []packageManager{
+	{Cmd: "apt", Name: "apt (Debian)", Native: []string{"debian", "ubuntu"}},
+	{Cmd: "dnf", Name: "dnf (Fedora)", Native: []string{"fedora", "rhel", "centos"}},
+	{Cmd: "yum", Name: "yum (RHEL)", Native: []string{"rhel", "centos"}},
+	{Cmd: "pacman", Name: "pacman (Arch)", Native: []string{"arch"}},
+	{Cmd: "zypper", Name: "zypper (openSUSE)", Native: []string{"opensuse", "suse", "sles"}},
+	{Cmd: "apk", Name: "apk (Alpine)", Native: []string{"alpine"}},
+	{Cmd: "brew", Name: "Homebrew", Native: []string{"darwin"}},
+	{Cmd: "port", Name: "MacPorts", Native: []string{"darwin"}},
+	{Cmd: "winget", Name: "winget", Native: []string{"windows"}},
+	{Cmd: "choco", Name: "Chocolatey", Native: []string{"windows"}},
+	{Cmd: "scoop", Name: "Scoop", Native: []string{"windows"}},
+	{Cmd: "snap", Name: "Snap", Universal: true},
+	{Cmd: "flatpak", Name: "Flatpak", Universal: true},
+	{Cmd: "nix", Name: "Nix", Universal: true},
+}
+
+// detectPackageManagersWith returns the installed package managers, native
+// ones for the OS or distribution (os-release ID and ID_LIKE) first, and
+// the primary one: the first unless only universal managers were found.
+func detectPackageManagersWith(sys Sys, distros []string) ([]string, string) {
+	rank := func(pm packageManager) int {
+		switch {
+		case pm.Universal:
+			return 2
+		case contains(pm.Native, sys.GOOS()):
+			return 0
+		}
+		for _, d := range distros {
+			if contains(pm.Native, d) {
+				return 0
+			}
+		}
+		return 1
+	}
+
+	var found []packageManager
+	for _, pm := range packageManagers {
+		if _, err := sys.LookPath(pm.Cmd); err == nil {
+			found = append(found, pm)
 		}
 	}
-	return managers
+	sort.SliceStable(found, func(i, j int) bool { return rank(found[i]) < rank(found[j]) })
+
+	var managers []string
+	for _, pm := range found {
+		managers = append(managers, pm.Name)
+	}
+	var primary string
+	if len(found) > 0 && !found[0].Universal {
+		primary = found[0].Name
+	}
+	return managers, primary
 }
 
 func detectUserPrivilegesWith(sys Sys) string {
@@ -595,40 +971,8 @@ func detectUserPrivilegesWith(sys Sys) string {
 	return strings.Join(privs, ", ")
 }
 
-func buildSystemPrompt() string {
-	return buildSystemPromptFrom(getSystemInfo())
-}
-
-func buildSystemPromptFrom(systemInfo string) string {
-	basePrompt := `You are an expert shell command assistant. Output exactly one single-line command that can be pasted into the user's shell and run as-is to complete the task.
-
-System Info:
-%s
-
-Strict output policy:
-1. Output ONLY the raw command on a single line. No commentary, no code fences, no leading/trailing spaces.
-2. Do NOT prefix with explanations (e.g., "Sure", "Run:") and do NOT use markdown.
-3. Prefer non-interactive, idempotent, and safe defaults; use flags that avoid prompts (-y, --noconfirm) when appropriate.
-4. Respect the detected OS, shell, and available package managers above. Prefer the most standard/common manager for that OS if multiple are present.
-5. If elevated privileges are required and sudo is available (Unix-like), prefix with sudo
-6. If the request is ambiguous, choose the most common and safest interpretation and produce a single best command.
-7. If no single applicable command exists, output a very short direct answer (still a single line).
-8. Avoid destructive operations unless explicitly requested; when editing files, prefer in-place options that create backups when available.
-9. Quote paths and arguments safely for the detected shell
-10. Favor cross-distro commands when possible; otherwise select the correct package manager from the detected list.
-
-Examples:
-- Request: install ripgrep
-  Response (apt): sudo apt update -y && sudo apt install -y ripgrep
-- Request: find and remove node_modules directories
-  Response (POSIX): find . -type d -name node_modules -prune -exec rm -rf {} +`
-
-	return fmt.Sprintf(basePrompt+"\n", systemInfo)
-}
-
 func main() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(reportError(os.Stderr, err))
 	}
 }
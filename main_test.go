@@ -17,11 +17,26 @@ func resetForTest(t *testing.T) string {
 	tmpDir := t.TempDir()
 	t.Setenv("HOW_CONFIG_DIR", tmpDir)
 
+	// Keys from the developer's environment must not satisfy tests
+	for _, k := range []string{"HOW_PROFILE", "HOW_API_KEY", "OPENROUTER_API_KEY", "OPENAI_API_KEY"} {
+		t.Setenv(k, "")
+	}
+
 	// Reset global flags/state that can leak between tests
 	modelFlag = ""
 	debug = false
 	runFlag = false
 	yesFlag = false
+	undoListFlag = false
+	profileFlag = ""
+	noContextFlag = false
+	copyFlag = false
+	candidatesFlag = 1
+	scriptFlag = false
+	noCacheFlag, refreshFlag = false, false
+	formatFlag = formatText
+	projectConfigPath = ""
+	setupProvider, setupKeyStdin, setupBaseURL, setupSkipValidation = "", false, "", false
 
 	// Reset viper to avoid cross-test contamination, then re-init config
 	viper.Reset()
@@ -30,6 +45,18 @@ func resetForTest(t *testing.T) string {
 	return tmpDir
 }
 
+// executeRoot runs the root command with args and returns what it wrote
+// to stdout.
+func executeRoot(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetArgs(args)
+	t.Cleanup(func() { rootCmd.SetOut(nil); rootCmd.SetArgs(nil) })
+	err := rootCmd.Execute()
+	return out.String(), err
+}
+
 func TestRoot_NoArgs_ShowsHelp(t *testing.T) {
 	_ = resetForTest(t)
 
@@ -97,8 +124,8 @@ func TestRoot_Query_PrintsCommand_AndAppendsHistory(t *testing.T) {
 	// Stub out the LLM call so we don't hit network.
 	orig := llmQuery
 	t.Cleanup(func() { llmQuery = orig })
-	llmQuery = func(endpoint, apiKey, query, model string, refererNeeded bool) (string, error) {
-		return "echo hi", nil
+	llmQuery = func(req LLMRequest) (LLMResponse, error) {
+		return LLMResponse{Content: "echo hi"}, nil
 	}
 
 	viper.Set("api_key", "dummy-test-key")
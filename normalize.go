@@ -0,0 +1,102 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// fenceRe matches a markdown code block, with or without a language tag,
+// including ```cmd``` on a single line.
+var fenceRe = regexp.MustCompile("(?s)```(?:[\\w+-]*[ \\t]*\\r?\\n)?(.*?)```")
+
+// chatterPrefixRe matches lead-ins models put before the command on the
+// same line, e.g. "Here's the command: ls".
+var chatterPrefixRe = regexp.MustCompile(`(?i)^(?:(?:sure|ok|okay|certainly)[,!.]?\s*)?(?:here(?:'s| is)(?: the| a| your)?(?: shell)? command(?: you need| to run)?|the command is|command|run(?: this| the following)?|try|use)\s*:\s*`)
+
+// inlineLeadRe matches prose that introduces an inline code span, e.g.
+// "You can run `ls -la`".
+var inlineLeadRe = regexp.MustCompile(`(?i)(?:\b(?:run|use|try|execute|with)|:)\s*$`)
+
+// extractFenced returns the contents of the first code block in s.
+func extractFenced(s string) (string, bool) {
+	m := fenceRe.FindStringSubmatch(s)
+	if m == nil {
+		return "", false
+	}
+	return strings.TrimSpace(m[1]), true
+}
+
+// normalizeResponse extracts the command from a plain-text reply that
+// ignores the output rules: code fences, inline backticks, lead-ins such as
+// "Here's the command:", a "$ " prompt and explanatory sentences around
+// the command. What cannot be cleaned up is left for the guardrail.
+func normalizeResponse(response string) string {
+	s := strings.TrimSpace(response)
+	if body, ok := extractFenced(s); ok {
+		s = body
+	}
+	s = dropChatterLines(s)
+	s = chatterPrefixRe.ReplaceAllString(s, "")
+	s = strings.TrimPrefix(s, "$ ")
+	s = stripInlineCode(s)
+	return strings.TrimSpace(s)
+}
+
+// dropChatterLines removes sentences before and after the command. A reply
+// that is all sentences is an answer and is kept as it is.
+func dropChatterLines(s string) string {
+	var lines []string
+	prose := true
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+			prose = prose && isChatter(l)
+		}
+	}
+	if prose {
+		return s
+	}
+	start, end := 0, len(lines)
+	for start < end-1 && isChatter(lines[start]) {
+		start++
+	}
+	for end > start+1 && isChatter(lines[end-1]) {
+		end--
+	}
+	if start == 0 && end == len(lines) {
+		return s
+	}
+	return strings.Join(lines[start:end], "\n")
+}
+
+// isChatter reports whether line is commentary rather than a command: a
+// lead-in ending with a colon, or a capitalized sentence.
+func isChatter(line string) bool {
+	if strings.HasSuffix(line, ":") {
+		return true
+	}
+	first := strings.Fields(line)[0]
+	if !unicode.IsUpper([]rune(first)[0]) || powerShellCmdletRe.MatchString(first) {
+		return false
+	}
+	return strings.ContainsAny(line[len(line)-1:], ".!?")
+}
+
+// stripInlineCode unwraps a command given as `cmd`, or introduced in a
+// sentence such as "Use `cmd` to ...". Commands that use backticks for
+// substitution are left alone.
+func stripInlineCode(s string) string {
+	if strings.Count(s, "`") != 2 {
+		return s
+	}
+	i := strings.Index(s, "`")
+	j := strings.LastIndex(s, "`")
+	if i == 0 && j == len(s)-1 {
+		return s[1:j]
+	}
+	if inlineLeadRe.MatchString(s[:i]) {
+		return s[i+1 : j]
+	}
+	return s
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestNormalizeResponse(t *testing.T) {
+	cases := []struct {
+		name, in, want string
+	}{
+		{"clean", "ls -la", "ls -la"},
+		{"surrounding whitespace", "  du -sh * | sort -h \n", "du -sh * | sort -h"},
+		{"bash fence", "```bash\nfind . -name '*.log' -delete\n```", "find . -name '*.log' -delete"},
+		{"sh fence with blank lines", "```sh\n\ndocker ps -a\n\n```\n", "docker ps -a"},
+		{"bare fence", "```\ngit log --oneline -5\n```", "git log --oneline -5"},
+		{"single-line fence", "```tar -xzf archive.tar.gz```", "tar -xzf archive.tar.gz"},
+		{"powershell fence", "```powershell\nGet-ChildItem -Recurse -Filter *.log\n```", "Get-ChildItem -Recurse -Filter *.log"},
+		{"lead-in and fence", "Here's the command:\n\n```bash\nsudo apt install -y ripgrep\n```", "sudo apt install -y ripgrep"},
+		{"fence and explanation", "```bash\nlsof -ti:8080 | xargs kill -9\n```\nThis kills whatever listens on port 8080.", "lsof -ti:8080 | xargs kill -9"},
+		{"inline backticks", "`ps aux --sort=-%mem | head`", "ps aux --sort=-%mem | head"},
+		{"prefix on same line", "Here's the command: df -h", "df -h"},
+		{"sure prefix", "Sure! Here is the command: uname -a", "uname -a"},
+		{"command prefix", "Command: free -m", "free -m"},
+		{"run prefix", "Run: npm ci", "npm ci"},
+		{"lead-in line", "To list open ports, run:\nss -tlnp", "ss -tlnp"},
+		{"trailing sentence", "du -sh .[!.]* * | sort -h\nThis shows the size of every entry, sorted.", "du -sh .[!.]* * | sort -h"},
+		{"sentence with inline code", "You can run `journalctl -u nginx --since today` to see today's logs.", "journalctl -u nginx --since today"},
+		{"use inline code", "Use `ss -tlnp` to list listening ports.", "ss -tlnp"},
+		{"shell prompt", "$ git status --short", "git status --short"},
+		{"fenced shell prompt", "```console\n$ make test\n```", "make test"},
+		{"command substitution kept", "echo `date`", "echo `date`"},
+		{"backticks in double quotes kept", "git commit -m \"fix `foo`\"", "git commit -m \"fix `foo`\""},
+		{"trailing dot argument", "cp -r ../src .", "cp -r ../src ."},
+		{"answer kept", "SSH listens on port 22 by default.", "SSH listens on port 22 by default."},
+		{"multi-line answer kept", "Port 22.\nChange it in /etc/ssh/sshd_config.", "Port 22.\nChange it in /etc/ssh/sshd_config."},
+		{"real multi-line left for the guardrail", "cd /tmp\nrm -rf build", "cd /tmp\nrm -rf build"},
+	}
+	for _, c := range cases {
+		if got := normalizeResponse(c.in); got != c.want {
+			t.Errorf("%s: normalizeResponse(%q) = %q, want %q", c.name, c.in, got, c.want)
+		}
+	}
+}
+
+func TestRoot_FencedReplyIsNormalized(t *testing.T) {
+	_ = resetForTest(t)
+	viper.Set("api_key", "k")
+	orig := llmQuery
+	t.Cleanup(func() { llmQuery = orig })
+	llmQuery = func(req LLMRequest) (LLMResponse, error) {
+		return LLMResponse{Content: "Here's the command:\n```bash\necho hi\n```"}, nil
+	}
+
+	out, err := executeRoot(t, "say", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "echo hi\n" {
+		t.Fatalf("stdout = %q", out)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+var formatFlag = formatText
+
+// Exit codes. Scripts and editor plugins rely on them, so existing values
+// must never change meaning.
+const (
+	exitError    = 1 // anything not covered below
+	exitUsage    = 2 // invalid flags or arguments
+	exitConfig   = 3 // missing API key, unknown profile, invalid settings
+	exitProvider = 4 // the provider failed or returned an unusable response
+	exitRefused  = 5 // blocked by policy, not confirmed or cancelled
+)
+
+var exitKinds = map[int]string{
+	exitError:    "error",
+	exitUsage:    "usage",
+	exitConfig:   "config",
+	exitProvider: "provider",
+	exitRefused:  "refused",
+}
+
+// codedError attaches an exit code to an error.
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err}
+}
+
+func exitCode(err error) int {
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+	return exitError
+}
+
+// JSONResult is what --format json prints for a generated command or, with
+// Type "answer", a direct answer.
+type JSONResult struct {
+	Type        string `json:"type"`
+	Command     string `json:"command"`
+	Explanation string `json:"explanation"`
+	Risk        string `json:"risk"`
+	Provider    string `json:"provider"`
+	Model       string `json:"model"`
+	Usage       *Usage `json:"usage"`
+	HistoryID   string `json:"history_id"`
+}
+
+type jsonError struct {
+	Error struct {
+		Kind     string `json:"kind"`
+		Message  string `json:"message"`
+		ExitCode int    `json:"exit_code"`
+	} `json:"error"`
+}
+
+func jsonOutput() bool { return formatFlag == formatJSON }
+
+func validateFormat() error {
+	switch formatFlag {
+	case formatText, formatJSON:
+		return nil
+	}
+	return withExitCode(exitUsage, fmt.Errorf("invalid --format %q (use text or json)", formatFlag))
+}
+
+func writeJSON(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// printResult prints command as plain text, or as a JSONResult for
+// --format json.
+func printResult(w io.Writer, command string, r JSONResult) error {
+	if !jsonOutput() {
+		_, err := fmt.Fprintln(w, command)
+		return err
+	}
+	if r.Type == "" {
+		r.Type = replyCommand
+	}
+	r.Command = command
+	// The local analysis can only raise what the model reported.
+	if local := assessRisk(command); r.Risk == "" || riskOrder[local] > riskOrder[r.Risk] {
+		r.Risk = local
+	}
+	return writeJSON(w, r)
+}
+
+// reportError prints err in the selected format and returns the exit code.
+func reportError(w io.Writer, err error) int {
+	code := exitCode(err)
+	if jsonOutput() {
+		var e jsonError
+		e.Error.Kind = exitKinds[code]
+		e.Error.Message = err.Error()
+		e.Error.ExitCode = code
+		_ = writeJSON(w, e)
+	} else {
+		_, _ = fmt.Fprintf(w, "Error: %v\n", err)
+	}
+	return code
+}
+
+// flagError marks flag parsing errors as usage errors. Usage is not
+// printed on errors, so point at --help instead.
+func flagError(cmd *cobra.Command, err error) error {
+	return withExitCode(exitUsage, fmt.Errorf("%w\nRun '%s --help' for usage", err, cmd.CommandPath()))
+}
+
+// usageArgs makes argument validation errors of cmd and its subcommands
+// usage errors too, like flagError does for flags.
+func usageArgs(cmd *cobra.Command) {
+	if validate := cmd.Args; validate != nil {
+		cmd.Args = func(c *cobra.Command, args []string) error {
+			if err := validate(c, args); err != nil {
+				return flagError(c, err)
+			}
+			return nil
+		}
+	}
+	for _, c := range cmd.Commands() {
+		usageArgs(c)
+	}
+}
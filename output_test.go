@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestFormatJSON_Query(t *testing.T) {
+	_ = resetForTest(t)
+	viper.Set("api_key", "dummy-test-key")
+	orig := llmQuery
+	t.Cleanup(func() { llmQuery = orig })
+	llmQuery = func(req LLMRequest) (LLMResponse, error) {
+		return LLMResponse{Content: "rm -rf build", Usage: &Usage{PromptTokens: 500, CompletionTokens: 4, TotalTokens: 504}}, nil
+	}
+
+	out, err := executeRoot(t, "--format", "json", "--model", "m1", "clean", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got JSONResult
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("stdout is not JSON: %v\n%s", err, out)
+	}
+	entry, err := readLastHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := JSONResult{
+		Command:   "rm -rf build",
+		Risk:      riskHigh,
+		Provider:  providerOpenRouter,
+		Model:     "m1",
+		Usage:     &Usage{PromptTokens: 500, CompletionTokens: 4, TotalTokens: 504},
+		HistoryID: entry.ID,
+	}
+	if got.Command != want.Command || got.Risk != want.Risk || got.Provider != want.Provider || got.Model != want.Model || *got.Usage != *want.Usage || got.HistoryID != want.HistoryID {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if !strings.Contains(out, `"explanation":""`) {
+		t.Fatalf("explanation should always be present: %s", out)
+	}
+}
+
+func TestFormatJSON_Last(t *testing.T) {
+	_ = resetForTest(t)
+	appendHistory(HistoryEntry{ID: "h1", Query: "q", Command: "ls", Provider: "openai", Model: "gpt"})
+
+	out, err := executeRoot(t, "last", "--format", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"command","command":"ls","explanation":"","risk":"low","provider":"openai","model":"gpt","usage":null,"history_id":"h1"}` + "\n"
+	if out != want {
+		t.Fatalf("got %s, want %s", out, want)
+	}
+
+	appendHistory(HistoryEntry{ID: "h2", Query: "q", Type: replyScript, Command: "cd /tmp\nls", Provider: "openai", Model: "gpt"})
+	out, err = executeRoot(t, "last", "--format", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got JSONResult
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != replyScript || got.Command != "cd /tmp\nls" || got.HistoryID != "h2" {
+		t.Fatalf("unexpected result %+v", got)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	_ = resetForTest(t)
+
+	_, err := executeRoot(t, "--format", "json", "list", "files")
+	if exitCode(err) != exitConfig {
+		t.Fatalf("missing API key: exit %d (%v)", exitCode(err), err)
+	}
+
+	_, err = executeRoot(t, "--no-such-flag", "x")
+	if exitCode(err) != exitUsage {
+		t.Fatalf("unknown flag: exit %d (%v)", exitCode(err), err)
+	}
+	_ = resetForTest(t)
+
+	_, err = executeRoot(t, "--format", "yaml", "x")
+	if exitCode(err) != exitUsage {
+		t.Fatalf("bad format: exit %d (%v)", exitCode(err), err)
+	}
+	_ = resetForTest(t)
+
+	_, err = executeRoot(t, "--format", "json", "--run", "x")
+	if exitCode(err) != exitUsage {
+		t.Fatalf("--run with json: exit %d (%v)", exitCode(err), err)
+	}
+	_ = resetForTest(t)
+
+	for _, args := range [][]string{{"config", "get"}, {"init", "tcsh"}, {"undo", "a", "b"}} {
+		_, err = executeRoot(t, args...)
+		if exitCode(err) != exitUsage || !strings.Contains(err.Error(), "--help") {
+			t.Fatalf("%v: exit %d (%v)", args, exitCode(err), err)
+		}
+	}
+	_ = resetForTest(t)
+
+	viper.Set("api_key", "k")
+	orig := llmQuery
+	t.Cleanup(func() { llmQuery = orig })
+	llmQuery = func(req LLMRequest) (LLMResponse, error) { return LLMResponse{}, errors.New("API error 500") }
+	_, err = executeRoot(t, "x")
+	if exitCode(err) != exitProvider {
+		t.Fatalf("provider failure: exit %d (%v)", exitCode(err), err)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	_ = resetForTest(t)
+	var buf bytes.Buffer
+	if code := reportError(&buf, errors.New("boom")); code != exitError || buf.String() != "Error: boom\n" {
+		t.Fatalf("text: code %d, output %q", code, buf.String())
+	}
+
+	formatFlag = formatJSON
+	buf.Reset()
+	code := reportError(&buf, withExitCode(exitRefused, errors.New("command blocked by policy rule \"rm\"")))
+	want := `{"error":{"kind":"refused","message":"command blocked by policy rule \"rm\"","exit_code":5}}` + "\n"
+	if code != exitRefused || buf.String() != want {
+		t.Fatalf("json: code %d, output %s", code, buf.String())
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultProfile names the top-level provider/api_key/model settings, which
+// act as the profile used when none is selected.
+const defaultProfile = "default"
+
+// profileKeys are the settings a profile carries. When a profile is active
+// they replace the top-level values entirely, so a work key is never paired
+// with a personal provider by accident.
+var profileKeys = []string{"provider", "api_key", "api_key_ref", "api_key_cmd", "model", "base_url"}
+
+var profileNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var (
+	profileFlag string
+
+	profileCmd = &cobra.Command{
+		Use:   "profile",
+		Short: "Manage named provider/key/model profiles",
+	}
+
+	profileAddCmd = &cobra.Command{
+		Use:   "add <name>",
+		Short: "Create or update a profile (same flags as setup)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateProfileName(args[0]); err != nil {
+				return err
+			}
+			return setupProfile(cmd, args[0])
+		},
+	}
+
+	profileListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List profiles; the active one is marked with *",
+		Args:  cobra.NoArgs,
+		RunE:  runProfileList,
+	}
+
+	profileUseCmd = &cobra.Command{
+		Use:   "use <name>",
+		Short: "Set the profile used by default ('default' for the top-level settings)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runProfileUse,
+	}
+
+	profileRemoveCmd = &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Delete a profile and its stored API key",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runProfileRemove,
+	}
+)
+
+func validateProfileName(name string) error {
+	if name == defaultProfile {
+		return fmt.Errorf("%q is reserved for the top-level settings; use 'how setup' instead", name)
+	}
+	if !profileNameRe.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q (use letters, digits, '-' and '_')", name)
+	}
+	return nil
+}
+
+// activeProfile returns the selected profile name, or "" for the top-level
+// settings. --profile wins over HOW_PROFILE, which wins over config.
+func activeProfile() string {
+	p := strings.TrimSpace(profileFlag)
+	if p == "" {
+		p = strings.TrimSpace(os.Getenv("HOW_PROFILE"))
+	}
+	if p == "" {
+		p = strings.TrimSpace(viper.GetString("profile"))
+	}
+	if p == defaultProfile {
+		return ""
+	}
+	return p
+}
+
+// profileKey returns the config key that holds key for profile.
+func profileKey(profile, key string) string {
+	if profile == "" {
+		return key
+	}
+	return "profiles." + profile + "." + key
+}
+
+func profileLabel(profile string) string {
+	if profile == "" {
+		return defaultProfile
+	}
+	return profile
+}
+
+func profileExists(name string) bool {
+	return viper.IsSet("profiles." + name)
+}
+
+// existingProfile returns the active profile for commands that save
+// settings into it. Unlike `profile add`, they must not create a profile
+// from a mistyped --profile or HOW_PROFILE.
+func existingProfile() (string, error) {
+	p := activeProfile()
+	if p == "" {
+		return "", nil
+	}
+	if err := validateProfileName(p); err != nil {
+		return "", withExitCode(exitUsage, err)
+	}
+	if !profileExists(p) {
+		return "", withExitCode(exitUsage, fmt.Errorf("profile %q not found. Create it with 'how profile add %s'", p, p))
+	}
+	return p, nil
+}
+
+// applyProfile layers the active profile's settings over the top-level ones.
+func applyProfile() error {
+	p := activeProfile()
+	if p == "" {
+		return nil
+	}
+	if !profileExists(p) {
+		return fmt.Errorf("profile %q not found. Create it with 'how profile add %s'", p, p)
+	}
+	m := map[string]any{}
+	for _, k := range profileKeys {
+		m[k] = viper.GetString(profileKey(p, k))
+	}
+	return viper.MergeConfigMap(m)
+}
+
+// secretName is the name the API key of profile is stored under.
+func secretName(profile, provider string) string {
+	if profile == "" {
+		return provider
+	}
+	return "profile-" + profile
+}
+
+func profileNames() []string {
+	var names []string
+	for name := range viper.GetStringMap("profiles") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func runProfileList(cmd *cobra.Command, args []string) error {
+	active := activeProfile()
+	out := cmd.OutOrStdout()
+
+	row := func(name, profile string) {
+		mark := " "
+		if profile == active {
+			mark = "*"
+		}
+		provider := viper.GetString(profileKey(profile, "provider"))
+		if provider == "" {
+			provider = providerOpenRouter
+		}
+		model := viper.GetString(profileKey(profile, "model"))
+		if model == "" {
+			model = "(provider default)"
+		}
+		_, _ = fmt.Fprintf(out, "%s %-12s %-11s %s\n", mark, name, provider, model)
+	}
+
+	row(defaultProfile, "")
+	for _, name := range profileNames() {
+		row(name, name)
+	}
+	return nil
+}
+
+func runProfileUse(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if name == defaultProfile {
+		if err := updateConfig(nil, "profile"); err != nil {
+			return err
+		}
+	} else {
+		if !profileExists(name) {
+			return fmt.Errorf("profile %q not found", name)
+		}
+		if err := updateConfig(map[string]any{"profile": name}); err != nil {
+			return err
+		}
+	}
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "✅ Now using profile %q\n", name)
+	return nil
+}
+
+func runProfileRemove(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+	if !profileExists(name) {
+		return fmt.Errorf("profile %q not found", name)
+	}
+
+	// Best-effort: the key may live in a store that is no longer reachable.
+	if ref := viper.GetString(profileKey(name, "api_key_ref")); ref != "" {
+		if backend, secret, ok := strings.Cut(ref, ":"); ok {
+			if store, err := secretStore(backend); err == nil && store != nil {
+				_ = store.Delete(secret)
+			}
+		}
+	}
+
+	unset := []string{"profiles." + name}
+	if viper.GetString("profile") == name {
+		unset = append(unset, "profile")
+	}
+	if err := updateConfig(nil, unset...); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "✅ Removed profile %q\n", name)
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func addProfile(t *testing.T, args ...string) {
+	t.Helper()
+	rootCmd.SetIn(strings.NewReader("key-" + args[0] + "\n"))
+	rootCmd.SetArgs(append([]string{"profile", "add", "--api-key-stdin", "--skip-validation"}, args...))
+	if _, err := rootCmd.ExecuteC(); err != nil {
+		t.Fatalf("profile add %s: %v", args[0], err)
+	}
+	setupProvider, modelFlag = "", ""
+}
+
+func TestProfile_AddUseQueryRemove(t *testing.T) {
+	cfgDir := resetForTest(t)
+	viper.Set("secret_backend", secretBackendFile)
+
+	addProfile(t, "work", "--provider", "openai", "--model", "gpt-4o-mini")
+	addProfile(t, "home", "--provider", "openrouter")
+
+	bOut := &bytes.Buffer{}
+	rootCmd.SetOut(bOut)
+	rootCmd.SetArgs([]string{"profile", "use", "work"})
+	if _, err := rootCmd.ExecuteC(); err != nil {
+		t.Fatal(err)
+	}
+
+	bOut.Reset()
+	rootCmd.SetArgs([]string{"profile", "list"})
+	if _, err := rootCmd.ExecuteC(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(bOut.String(), "* work") || !strings.Contains(bOut.String(), "  home") {
+		t.Fatalf("unexpected list:\n%s", bOut.String())
+	}
+
+	orig := llmQuery
+	t.Cleanup(func() { llmQuery = orig })
+	var gotKey, gotModel, gotEndpoint string
+	llmQuery = func(req LLMRequest) (LLMResponse, error) {
+		gotEndpoint, gotKey, gotModel = req.Endpoint, req.APIKey, req.Model
+		return LLMResponse{Content: "echo hi"}, nil
+	}
+
+	rootCmd.SetArgs([]string{"say", "hi"})
+	if _, err := rootCmd.ExecuteC(); err != nil {
+		t.Fatal(err)
+	}
+	if gotKey != "key-work" || gotModel != "gpt-4o-mini" || gotEndpoint != openAiURL {
+		t.Fatalf("work profile not applied: %q %q %q", gotKey, gotModel, gotEndpoint)
+	}
+
+	// --profile overrides the configured profile for one invocation.
+	rootCmd.SetArgs([]string{"--profile", "home", "say", "hi"})
+	if _, err := rootCmd.ExecuteC(); err != nil {
+		t.Fatal(err)
+	}
+	if gotKey != "key-home" || gotModel != openRouterDefaultModel {
+		t.Fatalf("home profile not applied: %q %q", gotKey, gotModel)
+	}
+	profileFlag = ""
+
+	hb, err := os.ReadFile(filepath.Join(cfgDir, "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsAll(string(hb), []string{`"profile":"work"`, `"profile":"home"`}) {
+		t.Fatalf("expected profiles in history:\n%s", hb)
+	}
+
+	rootCmd.SetArgs([]string{"profile", "remove", "work"})
+	if _, err := rootCmd.ExecuteC(); err != nil {
+		t.Fatal(err)
+	}
+	if got := profileNames(); len(got) != 1 || got[0] != "home" {
+		t.Fatalf("expected only home to remain, got %v", got)
+	}
+	if activeProfile() != "" {
+		t.Fatalf("expected removed active profile to be cleared, got %q", activeProfile())
+	}
+	if _, err := (fileStore{dir: cfgDir}).Get("profile-work"); err == nil {
+		t.Fatal("expected the profile's key to be deleted")
+	}
+}
+
+func TestProfile_UnknownProfileErrors(t *testing.T) {
+	_ = resetForTest(t)
+	t.Setenv("HOW_PROFILE", "ghost")
+	viper.Set("api_key", "k")
+
+	rootCmd.SetArgs([]string{"say", "hi"})
+	_, err := rootCmd.ExecuteC()
+	if err == nil || !strings.Contains(err.Error(), `profile "ghost" not found`) {
+		t.Fatalf("expected missing profile error, got: %v", err)
+	}
+}
+
+func TestProfile_RejectsReservedName(t *testing.T) {
+	_ = resetForTest(t)
+
+	rootCmd.SetArgs([]string{"profile", "add", "default"})
+	if _, err := rootCmd.ExecuteC(); err == nil || !strings.Contains(err.Error(), "reserved") {
+		t.Fatalf("expected reserved name error, got: %v", err)
+	}
+}
+
+func TestProfile_SetModelAndSetupRejectUnknownProfile(t *testing.T) {
+	cfgDir := resetForTest(t)
+
+	for _, args := range [][]string{
+		{"--profile", "wrok", "set-model", "gpt-4o-mini"},
+		{"--profile", "wrok", "setup", "--provider", "openai", "--api-key-stdin", "--skip-validation"},
+		{"--profile", "bad.name", "set-model", "gpt-4o-mini"},
+	} {
+		rootCmd.SetIn(strings.NewReader("k\n"))
+		rootCmd.SetArgs(args)
+		_, err := rootCmd.ExecuteC()
+		if exitCode(err) != exitUsage {
+			t.Fatalf("%v: exit %d (%v)", args, exitCode(err), err)
+		}
+		profileFlag = ""
+	}
+	if _, err := os.Stat(filepath.Join(cfgDir, "config.yaml")); !os.IsNotExist(err) {
+		t.Fatalf("expected no config to be written, stat err: %v", err)
+	}
+}
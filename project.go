@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const projectConfigName = ".how.yaml"
+
+// ProjectConfig is the subset of settings a repository may check in. Anything
+// that could redirect queries or credentials (provider, base_url, keys) is
+// deliberately not allowed.
+type ProjectConfig struct {
+	Model        string `yaml:"model"`
+	Instructions string `yaml:"instructions"`
+	Policy       struct {
+		Rules []string `yaml:"rules"`
+		Deny  []string `yaml:"deny"`
+	} `yaml:"policy"`
+}
+
+// projectConfigPath is the project file applied to this invocation, if any.
+var projectConfigPath string
+
+var trustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "Trust the .how.yaml of the current project",
+	Long:  "Show the nearest .how.yaml and mark its current contents as trusted, so it is applied without prompting.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, content, err := readProjectConfigFile()
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			return fmt.Errorf("no %s found in this directory or its parents", projectConfigName)
+		}
+		fmt.Fprintf(os.Stderr, "%s:\n%s\n", path, content)
+		if err := trustProjectConfig(path, content); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "✅ Trusted %s\n", path)
+		return nil
+	},
+}
+
+// findProjectConfig walks up from dir and returns the first .how.yaml found.
+func findProjectConfig(dir string) string {
+	for {
+		p := filepath.Join(dir, projectConfigName)
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+			return p
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func readProjectConfigFile() (string, []byte, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", nil, err
+	}
+	path := findProjectConfig(wd)
+	if path == "" {
+		return "", nil, nil
+	}
+	content, err := os.ReadFile(path)
+	return path, content, err
+}
+
+func trustStorePath() (string, error) {
+	dir, err := howConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "trusted_projects.json"), nil
+}
+
+// loadTrustStore maps project file paths to the SHA-256 of the contents the
+// user agreed to. Any edit to the file requires trusting it again.
+func loadTrustStore() map[string]string {
+	trusted := map[string]string{}
+	p, err := trustStorePath()
+	if err != nil {
+		return trusted
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return trusted
+	}
+	_ = json.Unmarshal(b, &trusted)
+	return trusted
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func trustProjectConfig(path string, content []byte) error {
+	trusted := loadTrustStore()
+	trusted[path] = contentHash(content)
+	b, err := json.MarshalIndent(trusted, "", "  ")
+	if err != nil {
+		return err
+	}
+	p, err := trustStorePath()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0600)
+}
+
+// promptTrust shows an untrusted project file and asks whether to apply it.
+// Unlike command confirmation, --yes does not answer this question.
+func promptTrust(path string, content []byte) bool {
+	if !isTTY(os.Stdin) || !isTTY(os.Stderr) {
+		fmt.Fprintf(os.Stderr, "⚠️  Ignoring untrusted %s. Run 'how trust' to apply it.\n", path)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "This project has a %s that changes how commands are generated:\n\n%s\n%s\n\n", projectConfigName, path, content)
+	fmt.Fprint(os.Stderr, "Trust it? [y/N] ")
+	in, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	in = strings.TrimSpace(strings.ToLower(in))
+	return in == "y" || in == "yes"
+}
+
+// loadProjectConfig finds, trust-checks and parses the project's .how.yaml.
+// It returns nil when there is none or the user does not trust it.
+func loadProjectConfig() (*ProjectConfig, string, error) {
+	path, content, err := readProjectConfigFile()
+	if err != nil || path == "" {
+		return nil, "", err
+	}
+
+	var pc ProjectConfig
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(&pc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", fmt.Errorf("%s: %w (only model, instructions and policy may be set)", path, err)
+	}
+
+	if loadTrustStore()[path] != contentHash(content) {
+		if !promptTrust(path, content) {
+			return nil, "", nil
+		}
+		if err := trustProjectConfig(path, content); err != nil {
+			return nil, "", err
+		}
+	}
+	return &pc, path, nil
+}
+
+// applyProjectConfig layers a trusted .how.yaml over the user config. The
+// model replaces the user's; instructions and policy rules are added to the
+// user's so a project can tighten but never drop the user's own deny list.
+func applyProjectConfig() error {
+	pc, path, err := loadProjectConfig()
+	if err != nil || pc == nil {
+		return err
+	}
+	projectConfigPath = path
+
+	m := map[string]any{
+		"policy": map[string]any{
+			"rules": append(viper.GetStringSlice("policy.rules"), pc.Policy.Rules...),
+			"deny":  append(viper.GetStringSlice("policy.deny"), pc.Policy.Deny...),
+		},
+	}
+	if pc.Model != "" {
+		m["model"] = pc.Model
+	}
+	if instr := strings.TrimSpace(pc.Instructions); instr != "" {
+		if user := strings.TrimSpace(viper.GetString("instructions")); user != "" {
+			instr = user + "\n" + instr
+		}
+		m["instructions"] = instr
+	}
+	return viper.MergeConfigMap(m)
+}
+
+// checkPolicy refuses commands matching any policy.deny pattern.
+func checkPolicy(command string) error {
+	for _, p := range viper.GetStringSlice("policy.deny") {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("invalid policy.deny pattern %q: %w", p, err)
+		}
+		if re.MatchString(command) {
+			return fmt.Errorf("command blocked by policy rule %q", p)
+		}
+	}
+	return nil
+}
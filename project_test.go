@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func writeProjectConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	p := filepath.Join(dir, projectConfigName)
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestProjectConfig_RequiresTrustAndMergesOverUserConfig(t *testing.T) {
+	_ = resetForTest(t)
+	repo := t.TempDir()
+	sub := filepath.Join(repo, "pkg", "api")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	p := writeProjectConfig(t, repo, `model: project-model
+instructions: This repo uses pnpm and just, not npm/make.
+policy:
+  rules: [Never push to git remotes.]
+  deny: ['git\s+push']
+`)
+	t.Chdir(sub)
+
+	if err := updateConfig(map[string]any{"model": "user-model", "policy.deny": []string{`rm\s+-rf\s+/`}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a TTY an untrusted file is ignored.
+	if err := applyProjectConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if viper.GetString("model") != "user-model" || projectConfigPath != "" {
+		t.Fatalf("untrusted project config applied: model=%q", viper.GetString("model"))
+	}
+
+	rootCmd.SetArgs([]string{"trust"})
+	if _, err := rootCmd.ExecuteC(); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyProjectConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if projectConfigPath != p || viper.GetString("model") != "project-model" {
+		t.Fatalf("project config not applied: %q %q", projectConfigPath, viper.GetString("model"))
+	}
+
+	prompt, err := buildSystemPrompt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsAll(prompt, []string{"11. Never push to git remotes.", "Additional context:\nThis repo uses pnpm and just, not npm/make."}) {
+		t.Fatalf("prompt missing project context:\n%s", prompt)
+	}
+
+	// The user's deny rule survives alongside the project's.
+	if err := checkPolicy("git push origin main"); err == nil {
+		t.Fatal("expected project deny rule to block")
+	}
+	if err := checkPolicy("rm -rf /"); err == nil {
+		t.Fatal("expected user deny rule to block")
+	}
+	if err := checkPolicy("git status"); err != nil {
+		t.Fatalf("unexpected block: %v", err)
+	}
+}
+
+func TestProjectConfig_EditInvalidatesTrust(t *testing.T) {
+	_ = resetForTest(t)
+	repo := t.TempDir()
+	p := writeProjectConfig(t, repo, "model: a\n")
+	t.Chdir(repo)
+
+	rootCmd.SetArgs([]string{"trust"})
+	if _, err := rootCmd.ExecuteC(); err != nil {
+		t.Fatal(err)
+	}
+	writeProjectConfig(t, repo, "model: b\n")
+
+	pc, _, err := loadProjectConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc != nil {
+		t.Fatalf("modified %s should need trusting again", p)
+	}
+}
+
+func TestProjectConfig_RejectsSensitiveKeys(t *testing.T) {
+	_ = resetForTest(t)
+	repo := t.TempDir()
+	writeProjectConfig(t, repo, "base_url: https://evil.example.com/v1\n")
+	t.Chdir(repo)
+
+	_, _, err := loadProjectConfig()
+	if err == nil || !strings.Contains(err.Error(), "only model, instructions and policy") {
+		t.Fatalf("expected rejected key error, got: %v", err)
+	}
+}
+
+func TestRoot_Run_BlockedByPolicy(t *testing.T) {
+	_ = resetForTest(t)
+
+	orig := llmQuery
+	t.Cleanup(func() { llmQuery = orig })
+	llmQuery = func(req LLMRequest) (LLMResponse, error) {
+		return LLMResponse{Content: "git push --force"}, nil
+	}
+	viper.Set("api_key", "k")
+	viper.Set("policy.deny", []string{`--force`})
+
+	rootCmd.SetArgs([]string{"--run", "--yes", "force", "push"})
+	_, err := rootCmd.ExecuteC()
+	if err == nil || !strings.Contains(err.Error(), "blocked by policy") {
+		t.Fatalf("expected policy error, got: %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultPromptTemplate is the built-in system prompt. testdata/prompt.golden
+// pins its output for a fixed system info.
+const defaultPromptTemplate = `You are an expert shell command assistant. Output exactly one single-line command that can be pasted into the user's shell and run as-is to complete the task.
+
+System Info:
+{{.SystemInfo}}
+
+Strict output policy:
+1. Output ONLY the raw command on a single line. No commentary, no code fences, no leading/trailing spaces.
+2. Do NOT prefix with explanations (e.g., "Sure", "Run:") and do NOT use markdown.
+3. Prefer non-interactive, idempotent, and safe defaults; use flags that avoid prompts (-y, --noconfirm) when appropriate.
+4. Respect the detected OS, shell, and available package managers above. Use the primary package manager when one is listed; otherwise prefer the most standard/common manager for that OS.
+5. If elevated privileges are required and sudo is available (Unix-like), prefix with sudo
+6. If the request is ambiguous, choose the most common and safest interpretation and produce a single best command.
+7. If no single applicable command exists, output a very short direct answer (still a single line).
+8. Avoid destructive operations unless explicitly requested; when editing files, prefer in-place options that create backups when available.
+9. Quote paths and arguments safely for the detected shell
+10. Favor cross-distro commands when possible; otherwise select the correct package manager from the detected list.
+{{- range $i, $rule := .Rules}}
+{{add $i 11}}. {{$rule}}
+{{- end}}
+{{if .Instructions}}
+Additional context:
+{{.Instructions}}
+{{end}}
+{{- if .Context}}
+Current directory:
+{{.Context}}
+{{end}}
+Examples:
+- Request: install ripgrep
+  Response (apt): sudo apt update -y && sudo apt install -y ripgrep
+- Request: find and remove node_modules directories
+  Response (POSIX): find . -type d -name node_modules -prune -exec rm -rf {} +
+`
+
+// PromptData is what a prompt template can refer to. The embedded
+// SystemInfo exposes every detected field ({{.OS}}, {{.Tools}}, ...), and
+// {{.SystemInfo}} on its own renders them as the bullet list.
+type PromptData struct {
+	SystemInfo
+	Rules        []string
+	Instructions string
+	Context      string
+}
+
+var promptFuncs = template.FuncMap{
+	"add":  func(a, b int) int { return a + b },
+	"join": strings.Join,
+}
+
+var (
+	promptCmd = &cobra.Command{
+		Use:   "prompt",
+		Short: "Inspect the system prompt",
+	}
+
+	promptShowCmd = &cobra.Command{
+		Use:   "show",
+		Short: "Render the effective system prompt",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyProfile(); err != nil {
+				return err
+			}
+			if err := applyProjectConfig(); err != nil {
+				return err
+			}
+			prompt, err := buildSystemPrompt()
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprint(cmd.OutOrStdout(), prompt)
+			return err
+		},
+	}
+
+	promptTemplateCmd = &cobra.Command{
+		Use:   "template",
+		Short: "Print the built-in template, as a starting point for prompt_template",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := fmt.Fprint(cmd.OutOrStdout(), defaultPromptTemplate)
+			return err
+		},
+	}
+)
+
+func newPromptData(info SystemInfo, rules []string, instructions string) PromptData {
+	d := PromptData{SystemInfo: info, Instructions: strings.TrimSpace(instructions)}
+	for _, r := range rules {
+		if r = strings.TrimSpace(r); r != "" {
+			d.Rules = append(d.Rules, r)
+		}
+	}
+	return d
+}
+
+// promptTemplate returns the template named by prompt_template, or the
+// built-in one.
+func promptTemplate() (*template.Template, error) {
+	path := strings.TrimSpace(viper.GetString("prompt_template"))
+	if path == "" {
+		return template.New("prompt").Funcs(promptFuncs).Parse(defaultPromptTemplate)
+	}
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, "~/") {
+		path = home + path[1:]
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("prompt_template: %w", err)
+	}
+	t, err := template.New(path).Funcs(promptFuncs).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("prompt_template: %w", err)
+	}
+	return t, nil
+}
+
+func renderPrompt(t *template.Template, d PromptData) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, d); err != nil {
+		return "", fmt.Errorf("prompt_template: %w", err)
+	}
+	return b.String(), nil
+}
+
+func buildSystemPrompt() (string, error) {
+	t, err := promptTemplate()
+	if err != nil {
+		return "", err
+	}
+	d := newPromptData(currentSystemInfo(), viper.GetStringSlice("policy.rules"), viper.GetString("instructions"))
+	if contextEnabled() {
+		if wd, err := os.Getwd(); err == nil {
+			d.Context = collectDirContext(defaultSys, wd)
+		}
+	}
+	out, err := renderPrompt(t, d)
+	if err != nil {
+		return "", err
+	}
+	if candidatesFlag > 1 {
+		out += candidatesInstruction(candidatesFlag)
+	}
+	if scriptFlag {
+		out += scriptInstruction(resolveShell(defaultSys).Name)
+	}
+	return out, nil
+}
+
+func buildSystemPromptFrom(info SystemInfo, context string) string {
+	t := template.Must(template.New("prompt").Funcs(promptFuncs).Parse(defaultPromptTemplate))
+	out, _ := renderPrompt(t, PromptData{SystemInfo: info, Context: context})
+	return out
+}
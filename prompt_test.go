@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"text/template"
+
+	"github.com/spf13/viper"
 )
 
 func TestBuildSystemPrompt_Golden(t *testing.T) {
-	info := "- OS: Linux\n- Architecture: amd64\n- Shell: bash"
-	got := buildSystemPromptFrom(info)
+	info := SystemInfo{OS: "Linux", Arch: "amd64", Shell: "bash"}
+	got := buildSystemPromptFrom(info, "")
 	want, err := os.ReadFile("testdata/prompt.golden")
 	if err != nil {
 		t.Fatal(err)
@@ -22,3 +27,77 @@ func TestBuildSystemPrompt_Golden(t *testing.T) {
 		t.Fatalf("prompt mismatch\nWANT:\n%s\nGOT:\n%s", string(want), got)
 	}
 }
+
+func TestPromptTemplate_UserTemplate(t *testing.T) {
+	cfgDir := resetForTest(t)
+
+	tmpl := filepath.Join(cfgDir, "prompt.tmpl")
+	content := `Shell={{.Shell}} OS={{.OS}} PMs={{join .PackageManagers "|"}}
+{{range .Rules}}* {{.}}
+{{end}}{{.Instructions}}`
+	if err := os.WriteFile(tmpl, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("prompt_template", tmpl)
+
+	info := SystemInfo{OS: "Linux", Arch: "amd64", Shell: "fish", PackageManagers: []string{"apt (Debian)", "Snap"}}
+	tp, err := promptTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := renderPrompt(tp, newPromptData(info, []string{"be brief", " "}, "uses just"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Shell=fish OS=Linux PMs=apt (Debian)|Snap\n* be brief\nuses just"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestPromptTemplate_Errors(t *testing.T) {
+	cfgDir := resetForTest(t)
+
+	viper.Set("prompt_template", filepath.Join(cfgDir, "missing.tmpl"))
+	if _, err := buildSystemPrompt(); err == nil || !strings.Contains(err.Error(), "prompt_template") {
+		t.Fatalf("expected missing file error, got: %v", err)
+	}
+
+	bad := filepath.Join(cfgDir, "bad.tmpl")
+	if err := os.WriteFile(bad, []byte("{{.NoSuchField}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("prompt_template", bad)
+	if _, err := buildSystemPrompt(); err == nil {
+		t.Fatal("expected execution error for unknown field")
+	}
+}
+
+func TestPromptShow_RendersEffectivePrompt(t *testing.T) {
+	_ = resetForTest(t)
+	if err := updateConfig(map[string]any{"instructions": "prefer podman"}); err != nil {
+		t.Fatal(err)
+	}
+
+	bOut := &bytes.Buffer{}
+	rootCmd.SetOut(bOut)
+	rootCmd.SetArgs([]string{"prompt", "show"})
+	if _, err := rootCmd.ExecuteC(); err != nil {
+		t.Fatal(err)
+	}
+	if !containsAll(bOut.String(), []string{"System Info:\n- OS:", "Additional context:\nprefer podman"}) {
+		t.Fatalf("unexpected prompt:\n%s", bOut.String())
+	}
+}
+
+func TestNewPromptData_ExposesSystemInfo(t *testing.T) {
+	info := SystemInfo{OS: "Linux", Kernel: "6.8.0", Arch: "arm64", PrimaryPackageManager: "apt (Debian)"}
+	tp := template.Must(template.New("t").Parse("{{.SystemInfo}}|{{.Kernel}}|{{.PrimaryPackageManager}}"))
+	got, err := renderPrompt(tp, newPromptData(info, nil, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := info.String() + "|6.8.0|apt (Debian)"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
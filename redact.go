@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+type detector struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// builtinDetectors find values that must not leave the machine. Order matters:
+// longer, more specific secrets are matched before the generic patterns that
+// could otherwise match a fragment of them.
+var builtinDetectors = []detector{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+	{"aws_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"api_key", regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{16,}|\bgh[pousr]_[A-Za-z0-9]{30,}|\bxox[abprs]-[A-Za-z0-9-]{10,}|\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"email", regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	{"ip", regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`)},
+}
+
+// Redactor replaces sensitive values with placeholders before text is sent to
+// a provider or written to disk.
+type Redactor struct {
+	detectors []detector
+}
+
+// Redactions maps placeholders back to the values they replaced.
+type Redactions struct {
+	originals map[string]string
+	order     []string
+}
+
+// newRedactorFromConfig builds a redactor from the built-in detectors minus
+// redact.disable, plus the regular expressions in redact.patterns.
+func newRedactorFromConfig() (*Redactor, error) {
+	if viper.IsSet("redact.enabled") && !viper.GetBool("redact.enabled") {
+		return &Redactor{}, nil
+	}
+
+	disabled := map[string]bool{}
+	for _, name := range viper.GetStringSlice("redact.disable") {
+		disabled[strings.TrimSpace(name)] = true
+	}
+
+	r := &Redactor{}
+	for _, d := range builtinDetectors {
+		if !disabled[d.name] {
+			r.detectors = append(r.detectors, d)
+		}
+	}
+	for _, p := range viper.GetStringSlice("redact.patterns") {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", p, err)
+		}
+		r.detectors = append(r.detectors, detector{"custom", re})
+	}
+	return r, nil
+}
+
+// Redact returns text with every detected value replaced by a placeholder
+// such as REDACTED_API_KEY_1. Equal values share a placeholder.
+func (r *Redactor) Redact(text string) (string, *Redactions) {
+	red := &Redactions{originals: map[string]string{}}
+	byValue := map[string]string{}
+	counts := map[string]int{}
+
+	for _, d := range r.detectors {
+		text = d.re.ReplaceAllStringFunc(text, func(v string) string {
+			if strings.HasPrefix(v, "REDACTED_") {
+				return v
+			}
+			if p, ok := byValue[v]; ok {
+				return p
+			}
+			counts[d.name]++
+			p := fmt.Sprintf("REDACTED_%s_%d", strings.ToUpper(d.name), counts[d.name])
+			byValue[v] = p
+			red.originals[p] = v
+			red.order = append(red.order, p)
+			return p
+		})
+	}
+	return text, red
+}
+
+// Count returns how many distinct values were redacted.
+func (r *Redactions) Count() int { return len(r.order) }
+
+// Restore puts the original values back in place of their placeholders.
+func (r *Redactions) Restore(text string) string {
+	// Replace longer placeholders first so REDACTED_IP_1 never eats into REDACTED_IP_10.
+	for i := len(r.order) - 1; i >= 0; i-- {
+		p := r.order[i]
+		text = strings.ReplaceAll(text, p, r.originals[p])
+	}
+	return text
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Reply types. A command is printed and may be run; an answer is a short
+// direct answer (rule 7 of the prompt); a refusal explains why the model
+// will not help.
+const (
+	replyCommand = "command"
+	replyAnswer  = "answer"
+	replyRefusal = "refusal"
+)
+
+// Reply is the model's structured response.
+type Reply struct {
+	Type         string `json:"type"`
+	Command      string `json:"command"`
+	Explanation  string `json:"explanation"`
+	RequiresSudo bool   `json:"requires_sudo"`
+	Destructive  bool   `json:"destructive"`
+}
+
+// ResponseFormat is the OpenAI response_format request field.
+type ResponseFormat struct {
+	Type       string          `json:"type"`
+	JSONSchema *JSONSchemaSpec `json:"json_schema,omitempty"`
+}
+
+type JSONSchemaSpec struct {
+	Name   string          `json:"name"`
+	Strict bool            `json:"strict"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+const replySchema = `{
+  "type": "object",
+  "properties": {
+    "type": {"type": "string", "enum": ["command", "answer", "refusal"]},
+    "command": {"type": "string"},
+    "explanation": {"type": "string"},
+    "requires_sudo": {"type": "boolean"},
+    "destructive": {"type": "boolean"}
+  },
+  "required": ["type", "command", "explanation", "requires_sudo", "destructive"],
+  "additionalProperties": false
+}`
+
+var replyResponseFormat = &ResponseFormat{
+	Type:       "json_schema",
+	JSONSchema: &JSONSchemaSpec{Name: "how_reply", Strict: true, Schema: json.RawMessage(replySchema)},
+}
+
+// structuredInstruction is appended to the system prompt when the reply is
+// requested as JSON; the output rules then apply to the command field.
+const structuredInstruction = `
+Response format: reply with a JSON object with these fields instead of the bare command. Rules 1 and 2 apply to the "command" field.
+- "type": "command" for a command, "answer" when rule 7 applies, "refusal" when you will not help.
+- "command": the single-line command; empty unless type is "command".
+- "explanation": one short sentence on what the command does, the answer itself, or why you refuse.
+- "requires_sudo": whether the command needs elevated privileges.
+- "destructive": whether the command deletes or overwrites data or could make the system unusable.
+`
+
+const (
+	structuredAuto = "auto"
+	structuredOn   = "on"
+	structuredOff  = "off"
+)
+
+// useStructuredOutput reports whether to ask for a JSON reply. In auto mode
+// only providers known to honour response_format are asked; others, and
+// anything behind base_url, keep the plain-text protocol.
+func useStructuredOutput(provider string) bool {
+	switch viper.GetString("structured_output") {
+	case structuredOn:
+		return true
+	case structuredOff:
+		return false
+	}
+	if viper.GetString("base_url") != "" {
+		return false
+	}
+	return provider == providerOpenAI || provider == providerOpenRouter
+}
+
+// replyBody is content without the code fence some models put around JSON.
+func replyBody(content string) string {
+	content = strings.TrimSpace(content)
+	if body, ok := extractFenced(content); ok {
+		return body
+	}
+	return content
+}
+
+// looksLikeJSON reports whether content is meant as a JSON reply, whether
+// or not it decodes.
+func looksLikeJSON(content string) bool {
+	return strings.HasPrefix(replyBody(content), "{")
+}
+
+// parseReply decodes a structured reply. ok is false when content is not a
+// usable reply.
+func parseReply(content string) (Reply, bool) {
+	var r Reply
+	if err := json.Unmarshal([]byte(replyBody(content)), &r); err != nil {
+		return Reply{}, false
+	}
+	r.Command = strings.TrimSpace(r.Command)
+	r.Explanation = strings.TrimSpace(r.Explanation)
+	switch r.Type {
+	case replyCommand:
+		if r.Command == "" {
+			return Reply{}, false
+		}
+	case replyAnswer, replyRefusal:
+		r.Command = ""
+	default:
+		return Reply{}, false
+	}
+	return r, true
+}
+
+// risk is what the model's own flags say about the command.
+func (r Reply) risk() string {
+	switch {
+	case r.Destructive:
+		return riskHigh
+	case r.RequiresSudo:
+		return riskMedium
+	}
+	return riskLow
+}
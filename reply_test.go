@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		content string
+		want    Reply
+		ok      bool
+	}{
+		{`{"type":"command","command":" ls -la ","explanation":"List files","requires_sudo":false,"destructive":false}`, Reply{Type: replyCommand, Command: "ls -la", Explanation: "List files"}, true},
+		{`{"type":"answer","command":"ignored","explanation":"Port 22.","requires_sudo":false,"destructive":false}`, Reply{Type: replyAnswer, Explanation: "Port 22."}, true},
+		{`{"type":"command","command":"","explanation":"x"}`, Reply{}, false},
+		{`{"type":"poem","command":"ls"}`, Reply{}, false},
+		{"```json\n{\"type\":\"command\",\"command\":\"df -h\",\"explanation\":\"Disk space\"}\n```", Reply{Type: replyCommand, Command: "df -h", Explanation: "Disk space"}, true},
+		{`ls -la`, Reply{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseReply(tt.content)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseReply(%s) = %+v, %v; want %+v, %v", tt.content, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestUseStructuredOutput(t *testing.T) {
+	_ = resetForTest(t)
+	if !useStructuredOutput(providerOpenAI) || !useStructuredOutput(providerOpenRouter) || useStructuredOutput("other") {
+		t.Fatal("unexpected auto defaults")
+	}
+	viper.Set("base_url", "http://localhost:11434/v1")
+	if useStructuredOutput(providerOpenAI) {
+		t.Fatal("auto should not assume a custom base_url supports JSON schema")
+	}
+	viper.Set("structured_output", structuredOn)
+	if !useStructuredOutput("other") {
+		t.Fatal("on should always ask")
+	}
+	viper.Set("structured_output", structuredOff)
+	if useStructuredOutput(providerOpenAI) {
+		t.Fatal("off should never ask")
+	}
+}
+
+func TestQueryLLM_Structured(t *testing.T) {
+	_ = resetForTest(t)
+	var requests []ChatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var body ChatRequest
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Fatalf("invalid json: %v", err)
+		}
+		requests = append(requests, body)
+		content := `{\"type\":\"command\",\"command\":\"ls\",\"explanation\":\"List\",\"requires_sudo\":false,\"destructive\":false}`
+		_, _ = io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"`+content+`"}}]}`)
+	}))
+	defer srv.Close()
+
+	resp, err := queryLLM(LLMRequest{Endpoint: srv.URL, Query: "list", Model: "m", Structured: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Structured {
+		t.Fatal("expected a structured response")
+	}
+	if r, ok := parseReply(resp.Content); !ok || r.Command != "ls" {
+		t.Fatalf("unexpected reply %q", resp.Content)
+	}
+	rf := requests[0].ResponseFormat
+	if rf == nil || rf.Type != "json_schema" || rf.JSONSchema.Name != "how_reply" || !strings.Contains(string(rf.JSONSchema.Schema), `"destructive"`) {
+		t.Fatalf("unexpected response_format %+v", rf)
+	}
+	if !strings.Contains(requests[0].Messages[0].Content, `"requires_sudo"`) {
+		t.Fatal("system prompt should describe the JSON fields")
+	}
+}
+
+func TestQueryLLM_StructuredFallback(t *testing.T) {
+	_ = resetForTest(t)
+	var requests []ChatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		var body ChatRequest
+		_ = json.Unmarshal(b, &body)
+		requests = append(requests, body)
+		if body.ResponseFormat != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"error":"response_format is not supported"}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"ls"}}]}`)
+	}))
+	defer srv.Close()
+
+	resp, err := queryLLM(LLMRequest{Endpoint: srv.URL, Query: "list", Model: "m", Structured: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Structured || resp.Content != "ls" || len(requests) != 2 {
+		t.Fatalf("expected a plain-text retry, got %+v after %d requests", resp, len(requests))
+	}
+	if strings.Contains(requests[1].Messages[0].Content, "Response format:") {
+		t.Fatal("the retry should use the plain-text prompt")
+	}
+}
+
+func stubStructuredReply(t *testing.T, r Reply) {
+	t.Helper()
+	b, _ := json.Marshal(r)
+	orig := llmQuery
+	t.Cleanup(func() { llmQuery = orig })
+	llmQuery = func(req LLMRequest) (LLMResponse, error) {
+		if !req.Structured {
+			t.Fatal("expected a structured request")
+		}
+		return LLMResponse{Content: string(b), Structured: true}, nil
+	}
+}
+
+func TestRoot_StructuredCommand(t *testing.T) {
+	_ = resetForTest(t)
+	viper.Set("api_key", "k")
+	stubStructuredReply(t, Reply{Type: replyCommand, Command: "find . -name '*.tmp' -delete", Explanation: "Delete temp files", Destructive: true})
+
+	out, err := executeRoot(t, "--format", "json", "delete", "temp", "files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got JSONResult
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != replyCommand || got.Explanation != "Delete temp files" || got.Risk != riskHigh {
+		t.Fatalf("unexpected result %+v", got)
+	}
+	entry, err := readLastHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Explanation != "Delete temp files" {
+		t.Fatalf("explanation not recorded: %+v", entry)
+	}
+}
+
+func TestRoot_StructuredAnswerIsNotRun(t *testing.T) {
+	_ = resetForTest(t)
+	viper.Set("api_key", "k")
+	stubStructuredReply(t, Reply{Type: replyAnswer, Explanation: "SSH listens on port 22 by default."})
+
+	out, err := executeRoot(t, "--run", "--yes", "which", "port", "does", "ssh", "use")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "# SSH listens on port 22 by default.\n" {
+		t.Fatalf("stdout = %q", out)
+	}
+	entry, err := readLastHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != replyAnswer || entry.Command != "" || entry.Explanation != "SSH listens on port 22 by default." {
+		t.Fatalf("answer not recorded: %+v", entry)
+	}
+}
+
+func TestRoot_StructuredRefusal(t *testing.T) {
+	_ = resetForTest(t)
+	viper.Set("api_key", "k")
+	stubStructuredReply(t, Reply{Type: replyRefusal, Explanation: "That would wipe the disk."})
+
+	_, err := executeRoot(t, "wipe", "everything")
+	if exitCode(err) != exitRefused || !strings.Contains(err.Error(), "wipe the disk") {
+		t.Fatalf("expected a refusal, got %v", err)
+	}
+	entry, err := readLastHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != replyRefusal || entry.Command != "" || entry.Explanation != "That would wipe the disk." {
+		t.Fatalf("refusal not recorded: %+v", entry)
+	}
+
+	out, err := executeRoot(t, "--run", "--yes", "last")
+	if exitCode(err) != exitRefused || out != "" {
+		t.Fatalf("last: got %q, exit %d (%v)", out, exitCode(err), err)
+	}
+}
+
+func TestRoot_StructuredReplyInFence(t *testing.T) {
+	_ = resetForTest(t)
+	viper.Set("api_key", "k")
+	orig := llmQuery
+	t.Cleanup(func() { llmQuery = orig })
+	llmQuery = func(req LLMRequest) (LLMResponse, error) {
+		return LLMResponse{Content: "```json\n{\"type\":\"command\",\"command\":\"df -h\",\"explanation\":\"Disk space\",\"requires_sudo\":false,\"destructive\":false}\n```", Structured: true}, nil
+	}
+
+	out, err := executeRoot(t, "disk", "space")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "df -h\n" {
+		t.Fatalf("stdout = %q", out)
+	}
+}
+
+func TestRoot_MalformedStructuredReplyIsRejected(t *testing.T) {
+	for _, content := range []string{`{"type":"command","command":"rm -rf /tmp/x"`, "```json\n{\"type\":\"command\",\"command\":\"\"}\n```"} {
+		_ = resetForTest(t)
+		viper.Set("api_key", "k")
+		orig := llmQuery
+		t.Cleanup(func() { llmQuery = orig })
+		llmQuery = func(req LLMRequest) (LLMResponse, error) {
+			return LLMResponse{Content: content, Structured: true}, nil
+		}
+
+		out, err := executeRoot(t, "--run", "--yes", "clean", "up")
+		if exitCode(err) != exitProvider || out != "" {
+			t.Fatalf("%s: got %q, exit %d (%v)", content, out, exitCode(err), err)
+		}
+		if _, err := readLastHistory(); err == nil {
+			t.Fatalf("%s: malformed reply recorded in history", content)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import "strings"
+
+const (
+	riskLow    = "low"
+	riskMedium = "medium"
+	riskHigh   = "high"
+)
+
+var riskOrder = map[string]int{riskLow: 0, riskMedium: 1, riskHigh: 2}
+
+// packageManagerCmds change installed software, which is worth a
+// confirmation but rarely destroys data.
+var packageManagerCmds = []string{"apt", "apt-get", "dnf", "yum", "pacman", "zypper", "apk", "brew", "port", "snap", "flatpak", "winget", "choco", "scoop", "npm", "pip", "pip3", "cargo", "gem"}
+
+// assessRisk is a local, best-effort classification of what command may
+// do: "high" for commands that can destroy data or the system, "medium" for
+// ones that change files, processes or packages, "low" otherwise. It reads
+// the command with the same parser undo uses and never asks the model.
+func assessRisk(command string) string {
+	risk := riskLow
+	raise := func(r string) {
+		if riskOrder[r] > riskOrder[risk] {
+			risk = r
+		}
+	}
+
+	for i, seg := range splitShellCommand(command) {
+		for _, target := range seg.Redirects {
+			switch {
+			case target == "/dev/null" || strings.HasPrefix(target, "/dev/std") || strings.HasPrefix(target, "&"):
+			case strings.HasPrefix(target, "/dev/"):
+				raise(riskHigh)
+			default:
+				raise(riskMedium)
+			}
+		}
+		if len(seg.Args) > 0 && (seg.Args[0] == "sudo" || seg.Args[0] == "doas") {
+			raise(riskMedium)
+		}
+
+		name, args := commandName(seg.Args)
+		switch {
+		case strings.HasPrefix(name, "mkfs"), contains([]string{"dd", "shred", "wipefs", "fdisk", "sfdisk", "parted", "shutdown", "reboot", "poweroff", "halt"}, name):
+			raise(riskHigh)
+		case name == "rm":
+			if hasFlag(args, "-r", "-R", "--recursive") {
+				raise(riskHigh)
+			}
+			raise(riskMedium)
+		case name == "chmod" || name == "chown" || name == "chgrp":
+			if hasFlag(args, "-R", "--recursive") {
+				raise(riskHigh)
+			}
+			raise(riskMedium)
+		case name == "git":
+			sub := strings.Join(args, " ")
+			switch {
+			case strings.HasPrefix(sub, "push") && hasFlag(args, "-f", "--force"),
+				strings.HasPrefix(sub, "reset") && hasFlag(args, "--hard"),
+				strings.HasPrefix(sub, "clean") && hasFlag(args, "-f", "-d", "-x"):
+				raise(riskHigh)
+			case strings.HasPrefix(sub, "push"), strings.HasPrefix(sub, "checkout"), strings.HasPrefix(sub, "rebase"):
+				raise(riskMedium)
+			}
+		case i > 0 && contains(knownShells, name) && !hasFlag(args, "-n"):
+			// Something piped into a shell, e.g. curl ... | sh.
+			raise(riskHigh)
+		case contains([]string{"kill", "pkill", "killall", "systemctl", "service", "crontab", "mount", "umount"}, name),
+			contains(packageManagerCmds, name):
+			raise(riskMedium)
+		case len(pathArguments(name, args)) > 0:
+			raise(riskMedium)
+		}
+	}
+	return risk
+}
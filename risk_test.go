@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestAssessRisk(t *testing.T) {
+	tests := map[string]string{
+		"ls -la":                                   riskLow,
+		"grep -r TODO . 2>/dev/null | sort":        riskLow,
+		"git status && git log --oneline":          riskLow,
+		"echo hi > notes.txt":                      riskMedium,
+		"sudo apt install -y ripgrep":              riskMedium,
+		"rm old.log":                               riskMedium,
+		"sed -i 's/a/b/' config.ini":               riskMedium,
+		"pkill -f node":                            riskMedium,
+		"rm -rf node_modules":                      riskHigh,
+		"sudo chmod -R 777 /var/www":               riskHigh,
+		"dd if=ubuntu.iso of=/dev/sdb bs=4M":       riskHigh,
+		"sudo mkfs.ext4 /dev/sdb1":                 riskHigh,
+		"curl -fsSL https://example.com/i.sh | sh": riskHigh,
+		"git push --force origin main":             riskHigh,
+		"git reset --hard HEAD~1":                  riskHigh,
+		"cat image.img > /dev/sda":                 riskHigh,
+	}
+	for command, want := range tests {
+		if got := assessRisk(command); got != want {
+			t.Errorf("assessRisk(%q) = %s, want %s", command, got, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// replyScript is the history and --format json type of --script output.
+const replyScript = "script"
+
+var scriptFlag bool
+
+// scriptInstruction is appended to the system prompt for --script,
+// overriding the single-line output rules.
+func scriptInstruction(shell string) string {
+	return fmt.Sprintf(`
+Script requested: instead of a single command, output a complete %s script that performs the task. It may span several lines and use loops, functions and heredocs.
+- Output only the script itself: no shebang line, no code fences, no commentary outside the script.
+- Keep comments inside the script short and only for steps that are not obvious.
+- Stop at the first failing step where the shell supports it (e.g. set -eu in POSIX shells).
+This replaces rules 1, 2, 6 and 7 for the output format only; every other rule still applies.
+`, shellLabel(shell))
+}
+
+// parseScript trims a --script reply, taking the script out of a code block
+// and dropping a shebang line, which is added for the resolved shell when
+// it is run.
+func parseScript(response string) string {
+	s := strings.TrimSpace(response)
+	if body, ok := extractFenced(s); ok {
+		s = body
+	}
+	lines := strings.Split(s, "\n")
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "#!") {
+		lines = lines[1:]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// scriptHeader returns the file extension and first line of a script file
+// for shell. Shells that do not read shebangs get none.
+func scriptHeader(shell Shell) (ext, header string) {
+	interpreter := shell.Path
+	if !filepath.IsAbs(interpreter) {
+		interpreter = "/usr/bin/env " + shell.Name
+	}
+	switch shell.Name {
+	case "pwsh":
+		return ".ps1", "#!" + interpreter
+	case "powershell":
+		return ".ps1", ""
+	case "cmd":
+		return ".cmd", ""
+	case "fish":
+		return ".fish", "#!" + interpreter
+	}
+	return ".sh", "#!" + interpreter
+}
+
+// writeScriptFile writes script to a new executable temporary file and
+// returns its path. The caller removes it.
+func writeScriptFile(shell Shell, script string) (string, error) {
+	ext, header := scriptHeader(shell)
+	f, err := os.CreateTemp("", "how-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	content := script + "\n"
+	if header != "" {
+		content = header + "\n" + content
+	}
+	if _, err := f.WriteString(content); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	if err := os.Chmod(f.Name(), 0o700); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// scriptCommand returns the command that runs the script file at path.
+func scriptCommand(shell Shell, path string) *exec.Cmd {
+	var c *exec.Cmd
+	switch shell.Name {
+	case "pwsh", "powershell":
+		c = exec.Command(shell.Path, "-NoProfile", "-File", path)
+	case "cmd":
+		c = exec.Command(shell.Path, "/C", path)
+	default:
+		c = exec.Command(shell.Path, path)
+	}
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return c
+}
+
+// pageText shows text in $PAGER (less or more by default) on the terminal,
+// falling back to printing it on stderr. Tests replace it.
+var pageText = func(text string) error {
+	pager := strings.TrimSpace(os.Getenv("PAGER"))
+	if pager == "" {
+		pager = "less"
+		if defaultSys.GOOS() == "windows" {
+			pager = "more"
+		}
+	}
+	args := strings.Fields(pager)
+	if _, err := exec.LookPath(args[0]); err != nil {
+		_, err := fmt.Fprintln(os.Stderr, text)
+		return err
+	}
+	c := exec.Command(args[0], args[1:]...)
+	c.Stdin = strings.NewReader(text)
+	// stdout may be redirected; the pager needs the terminal.
+	c.Stdout, c.Stderr = os.Stderr, os.Stderr
+	return c.Run()
+}
+
+// checkScriptPolicy applies policy.deny to the whole script and to each of
+// its lines, so that patterns anchored with ^ or $ still match.
+func checkScriptPolicy(script string) error {
+	if err := checkPolicy(script); err != nil {
+		return err
+	}
+	for _, line := range strings.Split(script, "\n") {
+		if err := checkPolicy(strings.TrimSpace(line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runScript runs a generated script after the same checks as a single
+// command: policy, review and confirmation, then a snapshot for undo.
+func runScript(script string, entry HistoryEntry) error {
+	if err := checkScriptPolicy(script); err != nil {
+		return withExitCode(exitRefused, err)
+	}
+	shell := resolveShell(defaultSys)
+	path, err := writeScriptFile(shell, script)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(path) }()
+
+	if !yesFlag && isTTY(os.Stdin) && isTTY(os.Stderr) {
+		if err := pageText(script); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Could not show the script: %v\n", err)
+		}
+	}
+	lines := strings.Count(script, "\n") + 1
+	if err := confirm("Run this script?", fmt.Sprintf("%s (%d lines, %s)", path, lines, shellLabel(shell.Name))); err != nil {
+		return withExitCode(exitRefused, err)
+	}
+	snapshotTouched(script, entry)
+	return scriptCommand(shell, path).Run()
+}
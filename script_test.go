@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseScript(t *testing.T) {
+	cases := map[string]string{
+		"set -eu\nfor f in *.log; do\n  gzip \"$f\"\ndone\n": "set -eu\nfor f in *.log; do\n  gzip \"$f\"\ndone",
+		"```bash\n#!/bin/bash\necho hi\necho there\n```":     "echo hi\necho there",
+		"#!/usr/bin/env sh\necho hi":                         "echo hi",
+	}
+	for in, want := range cases {
+		if got := parseScript(in); got != want {
+			t.Errorf("parseScript(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestScriptHeader(t *testing.T) {
+	cases := []struct {
+		shell      Shell
+		ext, first string
+	}{
+		{Shell{Name: "bash", Path: "/usr/bin/bash"}, ".sh", "#!/usr/bin/bash"},
+		{Shell{Name: "zsh", Path: "zsh"}, ".sh", "#!/usr/bin/env zsh"},
+		{Shell{Name: "fish", Path: "/usr/bin/fish"}, ".fish", "#!/usr/bin/fish"},
+		{Shell{Name: "powershell", Path: "powershell"}, ".ps1", ""},
+		{Shell{Name: "cmd", Path: "cmd"}, ".cmd", ""},
+	}
+	for _, c := range cases {
+		ext, first := scriptHeader(c.shell)
+		if ext != c.ext || first != c.first {
+			t.Errorf("scriptHeader(%v) = %q, %q; want %q, %q", c.shell, ext, first, c.ext, c.first)
+		}
+	}
+}
+
+func TestWriteScriptFile(t *testing.T) {
+	path, err := writeScriptFile(Shell{Name: "bash", Path: "/bin/bash"}, "echo one\necho two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "#!/bin/bash\necho one\necho two\n"; string(b) != want {
+		t.Fatalf("content = %q, want %q", b, want)
+	}
+	if !strings.HasSuffix(path, ".sh") {
+		t.Fatalf("unexpected name %s", path)
+	}
+	if fi, _ := os.Stat(path); runtime.GOOS != "windows" && fi.Mode().Perm() != 0o700 {
+		t.Fatalf("mode = %v", fi.Mode().Perm())
+	}
+}
+
+func TestCheckScriptPolicy_MatchesAnchoredPatternsPerLine(t *testing.T) {
+	_ = resetForTest(t)
+	viper.Set("policy.deny", []string{`^git\s+push`})
+
+	if err := checkScriptPolicy("git add -A\ngit commit -m wip"); err != nil {
+		t.Fatalf("unexpected block: %v", err)
+	}
+	if err := checkScriptPolicy("git add -A\n  git push --force"); err == nil {
+		t.Fatal("expected the push line to be blocked")
+	}
+}
+
+func TestRoot_ScriptRunsMultiLineReply(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	_ = resetForTest(t)
+	viper.Set("api_key", "k")
+	viper.Set("shell", "/bin/sh")
+	out := filepath.Join(t.TempDir(), "out.txt")
+
+	orig := llmQuery
+	t.Cleanup(func() { llmQuery = orig })
+	var prompt string
+	llmQuery = func(req LLMRequest) (LLMResponse, error) {
+		if req.Structured {
+			t.Error("--script must use the plain-text format")
+		}
+		prompt, _ = buildSystemPrompt()
+		return LLMResponse{Content: "```sh\nfor i in 1 2 3; do\n  echo \"$i\" >> '" + out + "'\ndone\n```"}, nil
+	}
+
+	stdout, err := executeRoot(t, "--script", "--run", "--yes", "write", "numbers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt, "Script requested") {
+		t.Fatalf("script instruction missing from prompt:\n%s", prompt)
+	}
+	if !strings.HasPrefix(stdout, "for i in 1 2 3; do\n") {
+		t.Fatalf("stdout = %q", stdout)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "1\n2\n3\n" {
+		t.Fatalf("script output = %q", b)
+	}
+	entry, err := readLastHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != replyScript || !strings.Contains(entry.Command, "\n") {
+		t.Fatalf("script not recorded: %+v", entry)
+	}
+}
+
+func TestRoot_ScriptWithCandidatesIsUsageError(t *testing.T) {
+	_ = resetForTest(t)
+	_, err := executeRoot(t, "--script", "-n", "2", "anything")
+	if exitCode(err) != exitUsage {
+		t.Fatalf("expected a usage error, got %v", err)
+	}
+}
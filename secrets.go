@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	secretBackendAuto    = "auto"
+	secretBackendKeyring = "keyring"
+	secretBackendFile    = "file"
+	secretBackendConfig  = "config"
+
+	keyringService = "how-cli"
+)
+
+var errSecretNotFound = errors.New("secret not found")
+
+// SecretStore keeps credentials outside of config.yaml. Config only holds a
+// reference of the form "<backend>:<name>".
+type SecretStore interface {
+	Name() string
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+}
+
+// keyringStore uses the Secret Service (GNOME Keyring, KWallet, KeePassXC)
+// through libsecret's secret-tool, so no cgo or D-Bus bindings are needed.
+type keyringStore struct{}
+
+func (keyringStore) Name() string { return secretBackendKeyring }
+
+func (keyringStore) Get(name string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keyringService, "account", name).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(out) == 0 {
+			return "", errSecretNotFound
+		}
+		return "", fmt.Errorf("secret-tool lookup: %w", err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+func (keyringStore) Set(name, value string) error {
+	c := exec.Command("secret-tool", "store", "--label=how-cli "+name, "service", keyringService, "account", name)
+	c.Stdin = strings.NewReader(value)
+	if out, err := c.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool store: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (keyringStore) Delete(name string) error {
+	return exec.Command("secret-tool", "clear", "service", keyringService, "account", name).Run()
+}
+
+// fileStore keeps secrets AES-256-GCM encrypted in secrets.json, with the key
+// in a separate 0600 file. Setting HOW_SECRETS_PASSPHRASE mixes a passphrase
+// into the key so that the two files alone are not enough to decrypt.
+type fileStore struct {
+	dir string
+}
+
+func (fileStore) Name() string { return secretBackendFile }
+
+func (s fileStore) aead() (cipher.AEAD, error) {
+	keyPath := filepath.Join(s.dir, "secret.key")
+	key, err := os.ReadFile(keyPath)
+	if os.IsNotExist(err) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(keyPath, key, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write(key)
+	h.Write([]byte(os.Getenv("HOW_SECRETS_PASSPHRASE")))
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s fileStore) load() (map[string]string, error) {
+	m := map[string]string{}
+	b, err := os.ReadFile(filepath.Join(s.dir, "secrets.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets.json: %w", err)
+	}
+	return m, nil
+}
+
+func (s fileStore) save(m map[string]string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(filepath.Join(s.dir, "secrets.json"), b)
+}
+
+func (s fileStore) Get(name string) (string, error) {
+	m, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	enc, ok := m[name]
+	if !ok {
+		return "", errSecretNotFound
+	}
+	raw, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return "", err
+	}
+	aead, err := s.aead()
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < aead.NonceSize() {
+		return "", fmt.Errorf("corrupt secret %q", name)
+	}
+	plain, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt secret %q (wrong HOW_SECRETS_PASSPHRASE?)", name)
+	}
+	return string(plain), nil
+}
+
+func (s fileStore) Set(name, value string) error {
+	aead, err := s.aead()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	m, err := s.load()
+	if err != nil {
+		return err
+	}
+	m[name] = base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(value), []byte(name)))
+	return s.save(m)
+}
+
+func (s fileStore) Delete(name string) error {
+	m, err := s.load()
+	if err != nil {
+		return err
+	}
+	delete(m, name)
+	return s.save(m)
+}
+
+// keyringAvailable reports whether a Secret Service can be reached. Headless
+// boxes usually have no session bus, so they fall back to the file store.
+func keyringAvailable(sys Sys) bool {
+	if sys.GOOS() != "linux" || sys.Env("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return false
+	}
+	_, err := sys.LookPath("secret-tool")
+	return err == nil
+}
+
+// secretStore returns the store selected by secret_backend. It returns nil
+// for the "config" backend, which keeps the key in config.yaml.
+func secretStore(backend string) (SecretStore, error) {
+	if backend == "" {
+		backend = viper.GetString("secret_backend")
+	}
+	switch backend {
+	case "", secretBackendAuto:
+		if keyringAvailable(defaultSys) {
+			return keyringStore{}, nil
+		}
+		return secretStore(secretBackendFile)
+	case secretBackendKeyring:
+		return keyringStore{}, nil
+	case secretBackendFile:
+		dir, err := howConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		return fileStore{dir: dir}, nil
+	case secretBackendConfig:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown secret_backend %q (want auto, keyring, file or config)", backend)
+}
+
+// storeAPIKey saves key under name in the configured secret store and
+// returns the config settings that reference it.
+func storeAPIKey(name, key string) (map[string]any, error) {
+	store, err := secretStore("")
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return map[string]any{"api_key": key}, nil
+	}
+	if err := store.Set(name, key); err != nil {
+		return nil, err
+	}
+	return map[string]any{"api_key_ref": store.Name() + ":" + name}, nil
+}
+
+// lookupSecretRef resolves an api_key_ref such as "keyring:openrouter".
+func lookupSecretRef(ref string) (string, error) {
+	backend, name, ok := strings.Cut(ref, ":")
+	if !ok || name == "" || backend == secretBackendConfig || backend == secretBackendAuto {
+		return "", fmt.Errorf("invalid api_key_ref %q", ref)
+	}
+	store, err := secretStore(backend)
+	if err != nil {
+		return "", err
+	}
+	v, err := store.Get(name)
+	if errors.Is(err, errSecretNotFound) {
+		return "", fmt.Errorf("API key %q not found in %s store. Please run 'how setup'", name, backend)
+	}
+	return strings.TrimSpace(v), err
+}
+
+// providerKeyEnv maps each provider to the environment variable its own
+// tooling conventionally reads the API key from.
+var providerKeyEnv = map[string]string{
+	providerOpenRouter: "OPENROUTER_API_KEY",
+	providerOpenAI:     "OPENAI_API_KEY",
+}
+
+// runKeyCommand runs api_key_cmd (e.g. "pass show openrouter") and returns the
+// first line of its output.
+func runKeyCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		c = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	// Password managers may need to prompt for a passphrase.
+	c.Stdin, c.Stderr = os.Stdin, os.Stderr
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("api_key_cmd failed: %w", err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+// resolveAPIKey returns the API key for provider and a description of where
+// it came from. Sources are tried in this order:
+//
+//  1. HOW_API_KEY
+//  2. the provider's standard variable (OPENROUTER_API_KEY, OPENAI_API_KEY)
+//  3. api_key_cmd in config.yaml
+//  4. api_key_ref in config.yaml (keyring or encrypted file)
+//  5. a plain-text api_key in config.yaml
+func resolveAPIKey(provider string) (key, source string, err error) {
+	if v := strings.TrimSpace(os.Getenv("HOW_API_KEY")); v != "" {
+		return v, "env HOW_API_KEY", nil
+	}
+	if name := providerKeyEnv[provider]; name != "" {
+		if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+			return v, "env " + name, nil
+		}
+	}
+	if c := viper.GetString("api_key_cmd"); c != "" {
+		v, err := runKeyCommand(c)
+		return v, "api_key_cmd", err
+	}
+	if ref := viper.GetString("api_key_ref"); ref != "" {
+		v, err := lookupSecretRef(ref)
+		return v, "api_key_ref " + ref, err
+	}
+	return viper.GetString("api_key"), "config api_key", nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestFileStore_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	s := fileStore{dir: dir}
+
+	if err := s.Set("openrouter", "sk-or-secret"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "secrets.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "sk-or-secret") {
+		t.Fatalf("secret stored in clear text: %s", b)
+	}
+
+	got, err := s.Get("openrouter")
+	if err != nil || got != "sk-or-secret" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	t.Setenv("HOW_SECRETS_PASSPHRASE", "other")
+	if _, err := s.Get("openrouter"); err == nil {
+		t.Fatal("expected decrypt error with a different passphrase")
+	}
+}
+
+func TestSetup_StoresKeyReferenceNotPlainText(t *testing.T) {
+	cfgDir := resetForTest(t)
+	viper.Set("secret_backend", secretBackendFile)
+
+	settings, err := storeAPIKey(providerOpenRouter, "sk-or-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := updateConfig(settings, "api_key"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfgPath := filepath.Join(cfgDir, "config.yaml")
+	b, err := os.ReadFile(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "sk-or-secret") || !strings.Contains(string(b), "api_key_ref: file:openrouter") {
+		t.Fatalf("unexpected config:\n%s", b)
+	}
+	if runtime.GOOS != "windows" {
+		if fi, err := os.Stat(cfgPath); err != nil || fi.Mode().Perm() != 0600 {
+			t.Fatalf("expected 0600 config, got %v (%v)", fi.Mode(), err)
+		}
+	}
+
+	key, source, err := resolveAPIKey(providerOpenRouter)
+	if err != nil || key != "sk-or-secret" || source != "api_key_ref file:openrouter" {
+		t.Fatalf("got %q from %q, %v", key, source, err)
+	}
+}
+
+func TestResolveAPIKey_Precedence(t *testing.T) {
+	_ = resetForTest(t)
+	t.Setenv("HOW_API_KEY", "")
+	t.Setenv("OPENAI_API_KEY", "")
+
+	viper.Set("api_key", "from-config")
+	if key, source, _ := resolveAPIKey(providerOpenAI); key != "from-config" || source != "config api_key" {
+		t.Fatalf("got %q from %q", key, source)
+	}
+
+	if runtime.GOOS != "windows" {
+		viper.Set("api_key_cmd", "printf 'from-cmd\\nsecond line'")
+		if key, source, err := resolveAPIKey(providerOpenAI); err != nil || key != "from-cmd" || source != "api_key_cmd" {
+			t.Fatalf("got %q from %q, %v", key, source, err)
+		}
+	}
+
+	t.Setenv("OPENAI_API_KEY", "from-provider-env")
+	if key, source, _ := resolveAPIKey(providerOpenAI); key != "from-provider-env" || source != "env OPENAI_API_KEY" {
+		t.Fatalf("got %q from %q", key, source)
+	}
+	// Another provider's variable must not leak into this one.
+	if key, _, _ := resolveAPIKey(providerOpenRouter); key == "from-provider-env" {
+		t.Fatal("OPENAI_API_KEY used for openrouter")
+	}
+
+	t.Setenv("HOW_API_KEY", "from-how-env")
+	if key, source, _ := resolveAPIKey(providerOpenAI); key != "from-how-env" || source != "env HOW_API_KEY" {
+		t.Fatalf("got %q from %q", key, source)
+	}
+}
+
+func TestUpdateConfig_UnsetKeepsOtherKeys(t *testing.T) {
+	cfgDir := resetForTest(t)
+
+	if err := updateConfig(map[string]any{"model": "m", "api_key": "plain", "redact.enabled": false}); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateConfig(nil, "api_key"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(cfgDir, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "api_key") || !containsAll(string(b), []string{"model: m", "enabled: false"}) {
+		t.Fatalf("unexpected config:\n%s", b)
+	}
+	if viper.IsSet("api_key") {
+		t.Fatalf("expected api_key to be unset in memory, got %q", viper.GetString("api_key"))
+	}
+}
+
+func TestLoosePermissions_WarnedAndTightenedOnWrite(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX modes only")
+	}
+	dir := resetForTest(t)
+	for _, f := range privateFiles {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte("{}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// WriteFile honours the umask; force the mode an old install had.
+		if err := os.Chmod(filepath.Join(dir, f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	warnLoosePermissions(dir)
+	os.Stderr = stderr
+	_ = w.Close()
+	warning, _ := io.ReadAll(r)
+
+	for _, f := range privateFiles {
+		p := filepath.Join(dir, f)
+		if !strings.Contains(string(warning), p+" is accessible by other users") {
+			t.Errorf("no warning for %s in %q", f, warning)
+		}
+		if fi, _ := os.Stat(p); fi.Mode().Perm() != 0644 {
+			t.Errorf("%s changed to %v by a check", f, fi.Mode().Perm())
+		}
+	}
+
+	// Files how writes are tightened.
+	if err := updateConfig(map[string]any{"model": "m"}); err != nil {
+		t.Fatal(err)
+	}
+	appendHistory(HistoryEntry{Query: "q", Command: "ls"})
+	if err := (fileStore{dir: dir}).save(map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"config.yaml", "history.jsonl", "secrets.json"} {
+		if fi, _ := os.Stat(filepath.Join(dir, f)); fi.Mode().Perm() != 0600 {
+			t.Errorf("%s: mode %v after writing", f, fi.Mode().Perm())
+		}
+	}
+}
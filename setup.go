@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	setupProvider       string
+	setupKeyStdin       bool
+	setupBaseURL        string
+	setupSkipValidation bool
+
+	validateAPIKey = checkAPIKey
+)
+
+var knownProviders = []string{providerOpenRouter, providerOpenAI}
+
+func runSetup(cmd *cobra.Command, args []string) error {
+	profile, err := existingProfile()
+	if err != nil {
+		return err
+	}
+	return setupProfile(cmd, profile)
+}
+
+// addSetupFlags registers the non-interactive setup flags on cmd, which is
+// shared by `setup` and `profile add`.
+func addSetupFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&setupProvider, "provider", "", "Provider to use (openrouter, openai); skips the interactive menu")
+	cmd.Flags().BoolVar(&setupKeyStdin, "api-key-stdin", false, "Read the API key from stdin without prompting")
+	cmd.Flags().StringVar(&setupBaseURL, "base-url", "", "OpenAI-compatible API base URL (e.g. http://localhost:11434/v1)")
+	cmd.Flags().BoolVar(&setupSkipValidation, "skip-validation", false, "Do not check the API key against the provider")
+}
+
+// setupProfile configures provider, key and model for profile ("" for the
+// top-level settings).
+func setupProfile(cmd *cobra.Command, profile string) error {
+	reader := bufio.NewReader(cmd.InOrStdin())
+	out := cmd.OutOrStdout()
+	interactive := !setupKeyStdin
+
+	provider := strings.ToLower(strings.TrimSpace(setupProvider))
+	if provider == "" {
+		_, _ = fmt.Fprintln(out, "Select AI Provider:")
+		_, _ = fmt.Fprintln(out, "1. OpenRouter (default)")
+		_, _ = fmt.Fprintln(out, "2. OpenAI")
+		_, _ = fmt.Fprint(out, "Choice [1]: ")
+
+		choice, _ := reader.ReadString('\n')
+		switch strings.TrimSpace(choice) {
+		case "2":
+			provider = providerOpenAI
+		default:
+			provider = providerOpenRouter
+		}
+		_, _ = fmt.Fprintln(out)
+	}
+	if !isKnownProvider(provider) {
+		return fmt.Errorf("unknown provider %q (want %s)", provider, strings.Join(knownProviders, ", "))
+	}
+
+	if interactive {
+		_, _ = fmt.Fprintf(out, "Enter your %s API key: ", provider)
+	}
+	apiKey, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	apiKey = strings.TrimSpace(apiKey)
+	if apiKey == "" && setupBaseURL == "" {
+		return fmt.Errorf("API key cannot be empty")
+	}
+
+	if !setupSkipValidation {
+		endpoint, _, _ := providerEndpoint(provider, setupBaseURL)
+		if err := validateAPIKey(provider, endpoint, apiKey); err != nil {
+			return fmt.Errorf("API key validation failed: %w (use --skip-validation to save it anyway)", err)
+		}
+	}
+
+	settings := map[string]any{}
+	if apiKey != "" {
+		if settings, err = storeAPIKey(secretName(profile, provider), apiKey); err != nil {
+			return fmt.Errorf("storing API key: %w", err)
+		}
+	}
+	settings["provider"] = provider
+	// Model IDs differ between providers, so the old model is cleared unless
+	// --model names a new one.
+	settings["model"] = strings.TrimSpace(modelFlag)
+
+	// Drop whatever the new settings do not use, so a plain-text key never
+	// lingers next to a keyring reference and a stale base_url is not kept.
+	var unset []string
+	for _, k := range []string{"api_key", "api_key_ref"} {
+		if _, ok := settings[k]; !ok {
+			unset = append(unset, k)
+		}
+	}
+	if setupBaseURL != "" {
+		settings["base_url"] = strings.TrimSpace(setupBaseURL)
+	} else {
+		unset = append(unset, "base_url")
+	}
+
+	scoped := map[string]any{}
+	for k, v := range settings {
+		scoped[profileKey(profile, k)] = v
+	}
+	for i, k := range unset {
+		unset[i] = profileKey(profile, k)
+	}
+	if err := updateConfig(scoped, unset...); err != nil {
+		return fmt.Errorf("saving config: %w", err)
+	}
+
+	if profile != "" {
+		_, _ = fmt.Fprintf(out, "✅ Profile %q saved successfully!\n", profile)
+		return nil
+	}
+	_, _ = fmt.Fprintln(out, "✅ Configuration saved successfully!")
+	return nil
+}
+
+func isKnownProvider(p string) bool {
+	for _, k := range knownProviders {
+		if p == k {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAPIKey makes a cheap authenticated request that fails on a bad key:
+// OpenRouter's key info endpoint, or the models list elsewhere.
+func checkAPIKey(provider, endpoint, apiKey string) error {
+	base := strings.TrimSuffix(endpoint, "/chat/completions")
+	url := base + "/models"
+	if provider == providerOpenRouter && endpoint == openRouterURL {
+		url = base + "/key"
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", url, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func stubValidation(t *testing.T, err error) *string {
+	t.Helper()
+	orig := validateAPIKey
+	t.Cleanup(func() { validateAPIKey = orig })
+	var got string
+	validateAPIKey = func(provider, endpoint, apiKey string) error {
+		got = provider + " " + endpoint + " " + apiKey
+		return err
+	}
+	return &got
+}
+
+func TestSetup_NonInteractiveWithFlags(t *testing.T) {
+	cfgDir := resetForTest(t)
+	viper.Set("secret_backend", secretBackendConfig)
+	validated := stubValidation(t, nil)
+
+	bOut := &bytes.Buffer{}
+	rootCmd.SetOut(bOut)
+	rootCmd.SetIn(strings.NewReader("sk-test\n"))
+	rootCmd.SetArgs([]string{"setup", "--provider", "openai", "--api-key-stdin", "--model", "gpt-4o-mini", "--base-url", "http://localhost:8080/v1/"})
+	if _, err := rootCmd.ExecuteC(); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	if *validated != "openai http://localhost:8080/v1/chat/completions sk-test" {
+		t.Fatalf("unexpected validation call: %q", *validated)
+	}
+	if strings.Contains(bOut.String(), "Select AI Provider") || strings.Contains(bOut.String(), "Enter your") {
+		t.Fatalf("expected no prompts, got: %s", bOut.String())
+	}
+
+	b, err := os.ReadFile(filepath.Join(cfgDir, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsAll(string(b), []string{"provider: openai", "model: gpt-4o-mini", "base_url: http://localhost:8080/v1", "api_key: sk-test"}) {
+		t.Fatalf("unexpected config:\n%s", b)
+	}
+}
+
+func TestSetup_ValidationFailureDoesNotSave(t *testing.T) {
+	cfgDir := resetForTest(t)
+	_ = stubValidation(t, errors.New("401 unauthorized"))
+
+	rootCmd.SetIn(strings.NewReader("bad-key\n"))
+	rootCmd.SetArgs([]string{"setup", "--provider", "openrouter", "--api-key-stdin"})
+	_, err := rootCmd.ExecuteC()
+	if err == nil || !strings.Contains(err.Error(), "validation failed") {
+		t.Fatalf("expected validation error, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfgDir, "config.yaml")); !os.IsNotExist(err) {
+		t.Fatalf("expected no config to be written, stat err: %v", err)
+	}
+}
+
+func TestSetup_RejectsUnknownProviderAndEmptyKey(t *testing.T) {
+	_ = resetForTest(t)
+	_ = stubValidation(t, nil)
+
+	rootCmd.SetIn(strings.NewReader("k\n"))
+	rootCmd.SetArgs([]string{"setup", "--provider", "nope", "--api-key-stdin"})
+	if _, err := rootCmd.ExecuteC(); err == nil || !strings.Contains(err.Error(), "unknown provider") {
+		t.Fatalf("expected unknown provider error, got: %v", err)
+	}
+
+	_ = resetForTest(t)
+	rootCmd.SetIn(strings.NewReader(""))
+	rootCmd.SetArgs([]string{"setup", "--provider", "openai", "--api-key-stdin"})
+	if _, err := rootCmd.ExecuteC(); err == nil || !strings.Contains(err.Error(), "cannot be empty") {
+		t.Fatalf("expected empty key error, got: %v", err)
+	}
+}
+
+func TestCheckAPIKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	endpoint := srv.URL + "/v1/chat/completions"
+	if err := checkAPIKey(providerOpenAI, endpoint, "good"); err != nil {
+		t.Fatalf("expected valid key, got: %v", err)
+	}
+	if err := checkAPIKey(providerOpenAI, endpoint, "bad"); err == nil {
+		t.Fatal("expected error for bad key")
+	}
+}
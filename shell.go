@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Shell is the shell commands are generated for and executed with.
+type Shell struct {
+	Name string // e.g. "fish", "pwsh"
+	Path string // what is executed; may be just the name for a PATH lookup
+}
+
+// knownShells are process names accepted as the user's interactive shell
+// when walking up the process tree.
+var knownShells = []string{
+	"bash", "zsh", "fish", "sh", "dash", "ash", "ksh", "mksh", "oksh", "yash",
+	"tcsh", "csh", "nu", "elvish", "xonsh", "pwsh", "powershell",
+}
+
+// maxShellAncestors bounds the walk up the process tree, which skips
+// wrappers such as sudo, env or make between the shell and how.
+const maxShellAncestors = 4
+
+// resolveShell decides which shell to target. The shell config key wins,
+// then the shell how was started from, then $SHELL (the login shell, which
+// is wrong for e.g. fish started inside bash). Both the prompt and command
+// execution use the result, so the generated syntax matches the executor.
+func resolveShell(sys Sys) Shell {
+	if s := strings.TrimSpace(viper.GetString("shell")); s != "" {
+		return shellFromPath(sys, s)
+	}
+	if sys.GOOS() == "windows" {
+		for _, name := range []string{"pwsh", "powershell"} {
+			if p, err := sys.LookPath(name); err == nil {
+				return Shell{Name: name, Path: p}
+			}
+		}
+		return Shell{Name: "cmd", Path: "cmd"}
+	}
+	if name := parentShellName(sys); name != "" {
+		if p, err := sys.LookPath(name); err == nil {
+			return Shell{Name: name, Path: p}
+		}
+	}
+	if s := sys.Env("SHELL"); s != "" {
+		return Shell{Name: filepath.Base(s), Path: s}
+	}
+	return Shell{Name: "sh", Path: "sh"}
+}
+
+func shellFromPath(sys Sys, s string) Shell {
+	name := strings.TrimSuffix(filepath.Base(s), ".exe")
+	if !strings.ContainsAny(s, `/\`) {
+		if p, err := sys.LookPath(s); err == nil {
+			return Shell{Name: name, Path: p}
+		}
+	}
+	return Shell{Name: name, Path: s}
+}
+
+// parentShellName returns the name of the nearest ancestor process that is
+// a known shell, or "".
+func parentShellName(sys Sys) string {
+	pid := sys.Getppid()
+	for i := 0; i < maxShellAncestors && pid > 1; i++ {
+		name, ppid := processInfo(sys, pid)
+		// Login shells show up as e.g. "-bash".
+		name = strings.TrimPrefix(name, "-")
+		if contains(knownShells, name) {
+			return name
+		}
+		pid = ppid
+	}
+	return ""
+}
+
+// processInfo returns the command name and parent pid of pid, from /proc on
+// Linux and ps elsewhere. ppid is 0 when unknown, which ends the walk.
+func processInfo(sys Sys, pid int) (string, int) {
+	id := strconv.Itoa(pid)
+	if sys.GOOS() == "linux" {
+		comm, err := sys.ReadFile("/proc/" + id + "/comm")
+		if err != nil {
+			return "", 0
+		}
+		ppid := 0
+		// The fields after the parenthesized command name start with the
+		// state and the ppid; the name itself may contain spaces.
+		if stat, err := sys.ReadFile("/proc/" + id + "/stat"); err == nil {
+			if i := strings.LastIndexByte(string(stat), ')'); i >= 0 {
+				if f := strings.Fields(string(stat)[i+1:]); len(f) > 1 {
+					ppid, _ = strconv.Atoi(f[1])
+				}
+			}
+		}
+		return strings.TrimSpace(string(comm)), ppid
+	}
+
+	out, err := sys.Output("ps", "-o", "ppid=,comm=", "-p", id)
+	if err != nil {
+		return "", 0
+	}
+	f := strings.Fields(string(out))
+	if len(f) < 2 {
+		return "", 0
+	}
+	ppid, _ := strconv.Atoi(f[0])
+	return filepath.Base(strings.Join(f[1:], " ")), ppid
+}
+
+// shellLabel is how a shell is described in the system prompt.
+func shellLabel(name string) string {
+	switch name {
+	case "pwsh":
+		return "PowerShell Core"
+	case "powershell":
+		return "Windows PowerShell"
+	case "cmd":
+		return "Command Prompt"
+	}
+	return name
+}
+
+// shellCommand returns the command that runs command with shell.
+func shellCommand(shell Shell, command string) *exec.Cmd {
+	var c *exec.Cmd
+	switch shell.Name {
+	case "pwsh", "powershell":
+		c = exec.Command(shell.Path, "-NoProfile", "-Command", command)
+	case "cmd":
+		c = exec.Command(shell.Path, "/C", command)
+	default:
+		c = exec.Command(shell.Path, "-c", command)
+	}
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return c
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestResolveShell_ParentProcess(t *testing.T) {
+	_ = resetForTest(t)
+	// fish started from a bash login shell: $SHELL still says bash.
+	fs := fakeSys{
+		goos: "linux",
+		env:  map[string]string{"SHELL": "/bin/bash"},
+		look: map[string]bool{"fish": true, "bash": true},
+		ppid: 200,
+		data: map[string]string{
+			"/proc/200/comm": "fish\n",
+			"/proc/200/stat": "200 (fish) S 100 200 200 0",
+		},
+	}
+	if got := resolveShell(fs); got.Name != "fish" || got.Path != "/bin/fish" {
+		t.Fatalf("got %+v, want fish", got)
+	}
+	if info := collectSystemInfo(fs); info.Shell != "fish" {
+		t.Fatalf("prompt shell = %q, want fish", info.Shell)
+	}
+}
+
+func TestResolveShell_SkipsWrappers(t *testing.T) {
+	_ = resetForTest(t)
+	fs := fakeSys{
+		goos: "linux",
+		look: map[string]bool{"zsh": true},
+		ppid: 300,
+		data: map[string]string{
+			"/proc/300/comm": "sudo\n",
+			"/proc/300/stat": "300 (sudo) S 250 300 300 0",
+			"/proc/250/comm": "tmux: server\n",
+			"/proc/250/stat": "250 (tmux: server) S 240 250 250 0",
+			"/proc/240/comm": "-zsh\n",
+			"/proc/240/stat": "240 (-zsh) S 1 240 240 0",
+		},
+	}
+	if got := resolveShell(fs); got.Name != "zsh" {
+		t.Fatalf("got %+v, want zsh", got)
+	}
+}
+
+func TestResolveShell_Fallbacks(t *testing.T) {
+	_ = resetForTest(t)
+	// Parent is not a shell: fall back to $SHELL, then sh.
+	fs := fakeSys{
+		goos: "linux",
+		env:  map[string]string{"SHELL": "/usr/bin/zsh"},
+		ppid: 400,
+		data: map[string]string{"/proc/400/comm": "make\n", "/proc/400/stat": "400 (make) S 1 400 400 0"},
+	}
+	if got := resolveShell(fs); got.Name != "zsh" || got.Path != "/usr/bin/zsh" {
+		t.Fatalf("got %+v, want $SHELL", got)
+	}
+	fs.env = nil
+	if got := resolveShell(fs); got.Name != "sh" {
+		t.Fatalf("got %+v, want sh", got)
+	}
+}
+
+func TestResolveShell_MacOSViaPs(t *testing.T) {
+	_ = resetForTest(t)
+	fs := fakeSys{
+		goos: "darwin",
+		look: map[string]bool{"fish": true},
+		ppid: 500,
+		out:  map[string]string{"ps -o ppid=,comm= -p 500": "  420 /opt/homebrew/bin/fish\n"},
+	}
+	if got := resolveShell(fs); got.Name != "fish" {
+		t.Fatalf("got %+v, want fish", got)
+	}
+}
+
+func TestResolveShell_ConfigOverride(t *testing.T) {
+	_ = resetForTest(t)
+	fs := fakeSys{
+		goos: "linux",
+		env:  map[string]string{"SHELL": "/bin/bash"},
+		look: map[string]bool{"nu": true},
+	}
+	viper.Set("shell", "nu")
+	if got := resolveShell(fs); got.Name != "nu" || got.Path != "/bin/nu" {
+		t.Fatalf("got %+v, want nu", got)
+	}
+	viper.Set("shell", "/usr/local/bin/fish")
+	if got := resolveShell(fs); got.Name != "fish" || got.Path != "/usr/local/bin/fish" {
+		t.Fatalf("got %+v, want fish path", got)
+	}
+}
+
+func TestResolveShell_Windows(t *testing.T) {
+	_ = resetForTest(t)
+	fs := fakeSys{goos: "windows", env: map[string]string{"SHELL": "/usr/bin/bash"}, look: map[string]bool{"powershell": true}}
+	got := resolveShell(fs)
+	if got.Name != "powershell" || shellLabel(got.Name) != "Windows PowerShell" {
+		t.Fatalf("got %+v", got)
+	}
+	if args := shellCommand(got, "dir").Args; len(args) != 4 || args[1] != "-NoProfile" || args[3] != "dir" {
+		t.Fatalf("unexpected args %v", args)
+	}
+}
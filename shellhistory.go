@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	bashTimestampRe = regexp.MustCompile(`(?m)^#\d{9,}$`)
+	zshExtendedRe   = regexp.MustCompile(`(?m)^: \d+:\d+;`)
+)
+
+func homeDir(sys Sys) (string, error) {
+	if h := sys.Env("HOME"); h != "" {
+		return h, nil
+	}
+	return os.UserHomeDir()
+}
+
+// shellHistoryFile returns the history file shell reads on startup, or ""
+// when the shell keeps no history file we know how to write.
+func shellHistoryFile(sys Sys, shell Shell) (string, error) {
+	home, err := homeDir(sys)
+	if err != nil {
+		return "", err
+	}
+	switch shell.Name {
+	case "bash":
+		// HISTFILE is usually a shell variable, so it is only seen when
+		// exported; ~/.bash_history is bash's default.
+		if f := sys.Env("HISTFILE"); f != "" {
+			return f, nil
+		}
+		return filepath.Join(home, ".bash_history"), nil
+	case "zsh":
+		if f := sys.Env("HISTFILE"); f != "" {
+			return f, nil
+		}
+		return filepath.Join(home, ".zsh_history"), nil
+	case "fish":
+		session := "fish"
+		if s := sys.Env("fish_history"); s != "" && s != "default" {
+			session = s
+		}
+		data := sys.Env("XDG_DATA_HOME")
+		if data == "" {
+			data = filepath.Join(home, ".local", "share")
+		}
+		return filepath.Join(data, "fish", session+"_history"), nil
+	}
+	return "", nil
+}
+
+// tailOf returns up to the last n bytes of path, which is enough to tell
+// which format an existing history file uses.
+func tailOf(path string, n int64) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = f.Close() }()
+	if fi, err := f.Stat(); err == nil && fi.Size() > n {
+		_, _ = f.Seek(fi.Size()-n, 0)
+	}
+	b := make([]byte, n)
+	m, _ := f.Read(b)
+	return string(b[:m])
+}
+
+// formatShellHistory renders command as an entry of shell's history file.
+// Bash gets a "#<epoch>" line when the file already uses them
+// (HISTTIMEFORMAT); zsh uses the extended format unless the file is plain.
+func formatShellHistory(shell string, existing, command string, now time.Time) string {
+	ts := now.Unix()
+	switch shell {
+	case "bash":
+		if bashTimestampRe.MatchString(existing) {
+			return fmt.Sprintf("#%d\n%s\n", ts, command)
+		}
+		return command + "\n"
+	case "zsh":
+		if existing != "" && !zshExtendedRe.MatchString(existing) {
+			return command + "\n"
+		}
+		return fmt.Sprintf(": %d:0;%s\n", ts, command)
+	case "fish":
+		escaped := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(command)
+		return fmt.Sprintf("- cmd: %s\n  when: %d\n", escaped, ts)
+	}
+	return ""
+}
+
+// appendShellHistory adds command to shell's history file so the shell's
+// own history finds commands run through how --run.
+func appendShellHistory(sys Sys, shell Shell, command string, now time.Time) error {
+	path, err := shellHistoryFile(sys, shell)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return fmt.Errorf("writing %s history is not supported", shell.Name)
+	}
+	existing := tailOf(path, 4096)
+	entry := formatShellHistory(shell.Name, existing, command, now)
+	if existing != "" && !strings.HasSuffix(existing, "\n") {
+		entry = "\n" + entry
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(entry); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
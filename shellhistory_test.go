@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendShellHistory(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		shell    string
+		file     string
+		env      map[string]string
+		existing string
+		want     string
+	}{
+		{"bash plain", "bash", ".bash_history", nil, "ls\n", "ls\ngit status\n"},
+		{"bash timestamps", "bash", ".bash_history", nil, "#1690000000\nls\n", "#1690000000\nls\n#1700000000\ngit status\n"},
+		{"bash HISTFILE", "bash", "custom_history", map[string]string{"HISTFILE": "custom_history"}, "", "git status\n"},
+		{"zsh new file", "zsh", ".zsh_history", nil, "", ": 1700000000:0;git status\n"},
+		{"zsh plain file", "zsh", ".zsh_history", nil, "ls\n", "ls\ngit status\n"},
+		{"zsh missing newline", "zsh", ".zsh_history", nil, ": 1690000000:0;ls", ": 1690000000:0;ls\n: 1700000000:0;git status\n"},
+		{"fish", "fish", ".local/share/fish/fish_history", nil, "- cmd: ls\n  when: 1690000000\n", "- cmd: ls\n  when: 1690000000\n- cmd: git status\n  when: 1700000000\n"},
+		{"fish session", "fish", "data/fish/work_history", map[string]string{"fish_history": "work", "XDG_DATA_HOME": "data"}, "", "- cmd: git status\n  when: 1700000000\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			env := map[string]string{"HOME": home}
+			for k, v := range tt.env {
+				env[k] = filepath.Join(home, v)
+				if k == "fish_history" {
+					env[k] = v
+				}
+			}
+			path := filepath.Join(home, tt.file)
+			if tt.existing != "" {
+				if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(tt.existing), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := appendShellHistory(fakeSys{env: env}, Shell{Name: tt.shell}, "git status", now); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendShellHistory_FishEscaping(t *testing.T) {
+	if got := formatShellHistory("fish", "", `printf 'a\tb'`, time.Unix(1, 0)); got != "- cmd: printf 'a\\\\tb'\n  when: 1\n" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestAppendShellHistory_Unsupported(t *testing.T) {
+	if err := appendShellHistory(fakeSys{env: map[string]string{"HOME": t.TempDir()}}, Shell{Name: "nu"}, "ls", time.Now()); err == nil {
+		t.Fatal("expected an error for nu")
+	}
+}
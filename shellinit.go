@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// The integration scripts bind Ctrl-G to a widget that sends the current
+// line to how and replaces the line with the generated command, so it can
+// be reviewed and edited before Enter and ends up in the shell's history.
+// "--" keeps queries starting with a dash or a subcommand name intact.
+
+const bashInitScript = `# how shell integration for bash. Add to ~/.bashrc:
+#   eval "$(how init bash)"
+__how_widget() {
+  [ -n "$READLINE_LINE" ] || return
+  local cmd
+  cmd="$(command how -- "$READLINE_LINE")" || return
+  [ -n "$cmd" ] || return
+  READLINE_LINE="$cmd"
+  READLINE_POINT=${#READLINE_LINE}
+}
+bind -x '"\C-g": __how_widget'
+`
+
+const zshInitScript = `# how shell integration for zsh. Add to ~/.zshrc:
+#   eval "$(how init zsh)"
+__how_widget() {
+  [[ -n "$BUFFER" ]] || return
+  local cmd
+  zle -I
+  cmd="$(command how -- "$BUFFER")"
+  if [[ $? -eq 0 && -n "$cmd" ]]; then
+    BUFFER="$cmd"
+    CURSOR=${#BUFFER}
+  fi
+  zle reset-prompt
+}
+zle -N __how_widget
+bindkey '^G' __how_widget
+`
+
+const fishInitScript = `# how shell integration for fish. Add to ~/.config/fish/config.fish:
+#   how init fish | source
+function __how_widget
+    set -l query (commandline | string collect)
+    test -n "$query"; or return
+    set -l cmd (command how -- "$query" | string collect)
+    if test $pipestatus[1] -eq 0 -a -n "$cmd"
+        commandline -r -- $cmd
+        commandline -f end-of-line
+    end
+    commandline -f repaint
+end
+bind \cg __how_widget
+bind -M insert \cg __how_widget
+`
+
+var shellInitScripts = map[string]string{
+	"bash": bashInitScript,
+	"zsh":  zshInitScript,
+	"fish": fishInitScript,
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init <bash|zsh|fish>",
+	Short: "Print shell integration that turns the current line into a command with Ctrl-G",
+	Long: "Print a shell function bound to Ctrl-G that sends the current command line to how\n" +
+		"and replaces it with the generated command, ready to edit and run.\n\n" +
+		"  bash: eval \"$(how init bash)\"   in ~/.bashrc\n" +
+		"  zsh:  eval \"$(how init zsh)\"    in ~/.zshrc\n" +
+		"  fish: how init fish | source    in ~/.config/fish/config.fish",
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := fmt.Fprint(cmd.OutOrStdout(), shellInitScripts[args[0]])
+		return err
+	},
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInit_Scripts(t *testing.T) {
+	_ = resetForTest(t)
+	for shell, binding := range map[string]string{"bash": `bind -x '"\C-g": __how_widget'`, "zsh": "bindkey '^G' __how_widget", "fish": `bind \cg __how_widget`} {
+		out, err := executeRoot(t, "init", shell)
+		if err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		if !strings.Contains(out, binding) || !strings.Contains(out, "command how -- ") {
+			t.Fatalf("%s script missing binding or how call:\n%s", shell, out)
+		}
+	}
+	if _, err := executeRoot(t, "init", "tcsh"); err == nil {
+		t.Fatal("expected an error for an unsupported shell")
+	}
+}
+
+func TestInit_SyntaxCheck(t *testing.T) {
+	for shell, check := range map[string][]string{"bash": {"-n"}, "zsh": {"-n"}, "fish": {"--no-execute"}} {
+		path, err := exec.LookPath(shell)
+		if err != nil {
+			continue
+		}
+		script := filepath.Join(t.TempDir(), "init."+shell)
+		if err := os.WriteFile(script, []byte(shellInitScripts[shell]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := exec.Command(path, append(check, script)...).CombinedOutput(); err != nil {
+			t.Fatalf("%s rejects its init script: %v\n%s", shell, err, out)
+		}
+	}
+}
+
+func TestInit_BashWidgetReplacesLine(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+	// A stand-in for how that answers with a fixed command.
+	bin := t.TempDir()
+	fake := "#!/bin/sh\n[ \"$1\" = -- ] && echo \"ls -la # $2\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "how"), []byte(fake), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	script := shellInitScripts["bash"] + `READLINE_LINE="list files"
+__how_widget
+printf '%s|%s' "$READLINE_LINE" "$READLINE_POINT"
+`
+	c := exec.Command(bash, "-c", script)
+	c.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	if err := c.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), "ls -la # list files|19"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const defaultSuggestMinSimilarity = 60
+
+// stopWords carry no meaning for matching queries.
+var stopWords = []string{"a", "an", "the", "of", "in", "on", "to", "for", "and", "or", "by", "with", "all", "my", "me", "i", "how", "do", "is", "this"}
+
+// readHistory returns every entry of history.jsonl, oldest first, skipping
+// lines it cannot parse.
+func readHistory() ([]HistoryEntry, error) {
+	p, err := historyFilePath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var entries []HistoryEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e HistoryEntry
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, sc.Err()
+}
+
+// queryWords is the normalized query split into words without punctuation.
+func queryWords(q string) []string {
+	var words []string
+	for _, w := range strings.Fields(normalizeQuery(q)) {
+		if w = strings.Trim(w, `"'.,;:!?()`); w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+func queryTokens(q string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range queryWords(q) {
+		if !contains(stopWords, w) {
+			set[w] = true
+		}
+	}
+	return set
+}
+
+func queryTrigrams(q string) map[string]bool {
+	set := map[string]bool{}
+	rs := []rune(" " + strings.Join(queryWords(q), " ") + " ")
+	for i := 0; i+3 <= len(rs); i++ {
+		set[string(rs[i:i+3])] = true
+	}
+	return set
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	n := 0
+	for k := range a {
+		if b[k] {
+			n++
+		}
+	}
+	return float64(n) / float64(len(a)+len(b)-n)
+}
+
+// actionWords are verbs whose presence in only one of two queries changes
+// what is asked for, however similar the rest is ("start" or "stop" all
+// docker containers).
+var actionWords = []string{
+	"start", "stop", "restart", "enable", "disable", "mount", "unmount", "umount",
+	"install", "uninstall", "add", "remove", "delete", "create", "kill", "open", "close",
+	"show", "hide", "lock", "unlock", "allow", "deny", "block", "unblock", "compress",
+	"decompress", "extract", "zip", "unzip", "encrypt", "decrypt", "upload", "download",
+	"push", "pull", "increase", "decrease", "enlarge", "shrink", "attach", "detach",
+	"connect", "disconnect", "pause", "resume", "freeze", "unfreeze", "include", "exclude",
+	"import", "export", "load", "unload", "link", "unlink", "set", "unset", "grant", "revoke",
+}
+
+// negationWords turn a query into its opposite.
+var negationWords = []string{"not", "no", "don't", "dont", "never", "without", "except", "excluding", "non"}
+
+// conflictingQueries reports whether two otherwise similar queries ask for
+// different things: a verb or negation appears in only one of them, or a
+// word in one is the other's un-, dis- or de- prefixed opposite.
+func conflictingQueries(a, b string) bool {
+	wa, wb := map[string]bool{}, map[string]bool{}
+	for _, w := range queryWords(a) {
+		wa[w] = true
+	}
+	for _, w := range queryWords(b) {
+		wb[w] = true
+	}
+	differs := func(x, y map[string]bool) bool {
+		for w := range x {
+			if y[w] {
+				continue
+			}
+			if contains(actionWords, w) || contains(negationWords, w) {
+				return true
+			}
+			for _, prefix := range []string{"un", "dis", "de"} {
+				if y[strings.TrimPrefix(w, prefix)] || y[prefix+w] {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return differs(wa, wb) || differs(wb, wa)
+}
+
+// querySimilarity scores two queries from 0 to 1, averaging word overlap
+// (which ignores word order) and trigram overlap (which tolerates typos
+// and inflections such as dir/directory).
+func querySimilarity(a, b string) float64 {
+	return (jaccard(queryTokens(a), queryTokens(b)) + jaccard(queryTrigrams(a), queryTrigrams(b))) / 2
+}
+
+// similarHistory returns the past command whose query is most like query,
+// if it scores at least minScore. Only commands that can be run as they
+// are here qualify: same OS and shell, same kind (command or script) and
+// no redacted values. Queries that differ in a verb or a negation never
+// match. Ties go to the most recent entry.
+func similarHistory(entries []HistoryEntry, query, goos, shell, kind string, minScore float64) (*HistoryEntry, float64) {
+	var best *HistoryEntry
+	bestScore := minScore
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := &entries[i]
+		if e.Type != kind || e.Redacted || strings.TrimSpace(e.Command) == "" || e.OS != goos || e.Shell != shell {
+			continue
+		}
+		if conflictingQueries(query, e.Query) {
+			continue
+		}
+		if s := querySimilarity(query, e.Query); s > bestScore || (best == nil && s == bestScore) {
+			best, bestScore = e, s
+		}
+	}
+	if best == nil {
+		return nil, 0
+	}
+	return best, bestScore
+}
+
+// offerHistory shows a past command and asks whether to reuse it. Only y
+// reuses it; Enter or anything else asks the model.
+func offerHistory(in io.Reader, out io.Writer, e *HistoryEntry) bool {
+	_, _ = fmt.Fprintf(out, "You ran this before, for %q:\n", e.Query)
+	for _, line := range strings.Split(e.Command, "\n") {
+		_, _ = fmt.Fprintf(out, "  %s\n", line)
+	}
+	_, _ = fmt.Fprint(out, "Reuse it? [y/N, N asks the model] ")
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
+
+// reuseTerminal returns where to offer a past command, and false when
+// there is no terminal to ask on.
+var reuseTerminal = func() (io.Reader, io.Writer, bool) {
+	return os.Stdin, os.Stderr, isTTY(os.Stdin) && isTTY(os.Stderr)
+}
+
+// suggestFromHistory offers a similar past command before the model is
+// asked. It only does so on a terminal, and never for -n, JSON output or
+// --refresh. It returns the entry to reuse, or nil.
+func suggestFromHistory(safeQuery string) *HistoryEntry {
+	if !viper.GetBool("suggest.enabled") || candidatesFlag > 1 || jsonOutput() || refreshFlag {
+		return nil
+	}
+	in, out, ok := reuseTerminal()
+	if !ok {
+		return nil
+	}
+	entries, err := readHistory()
+	if err != nil || len(entries) == 0 {
+		return nil
+	}
+	kind := ""
+	if scriptFlag {
+		kind = replyScript
+	}
+	minScore := float64(viper.GetInt("suggest.min_similarity")) / 100
+	e, score := similarHistory(entries, safeQuery, runtime.GOOS, resolveShell(defaultSys).Name, kind, minScore)
+	if e == nil {
+		return nil
+	}
+	if debug {
+		fmt.Fprintf(os.Stderr, "History match: %.0f%% similar to %q\n", score*100, e.Query)
+	}
+	if !offerHistory(in, out, e) {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestQuerySimilarity(t *testing.T) {
+	if s := querySimilarity("disk usage of current dir sorted", "Disk usage of current dir, sorted?"); s != 1 {
+		t.Errorf("equivalent queries scored %.2f", s)
+	}
+	similar := querySimilarity("disk usage of current dir sorted", "sorted disk usage of the current directory")
+	unrelated := querySimilarity("disk usage of current dir sorted", "kill the process on port 8080")
+	if similar < 0.6 {
+		t.Errorf("similar queries scored %.2f", similar)
+	}
+	if unrelated > 0.2 {
+		t.Errorf("unrelated queries scored %.2f", unrelated)
+	}
+}
+
+func TestSimilarHistory(t *testing.T) {
+	here := func(q, c string) HistoryEntry {
+		return HistoryEntry{Query: q, Command: c, OS: "linux", Shell: "bash"}
+	}
+	entries := []HistoryEntry{
+		here("disk usage of current dir sorted", "du -sh * | sort -h"),
+		{Query: "disk usage of current dir sorted", Command: "Get-ChildItem | Sort Length", OS: "windows", Shell: "pwsh"},
+		{Query: "disk usage of current dir sorted", Command: "du -sh * | sort -h", OS: "linux", Shell: "fish"},
+		{Query: "disk usage of current dir sorted", Command: "du -sh <SECRET_1>", OS: "linux", Shell: "bash", Redacted: true},
+		{Query: "disk usage of current dir sorted", Type: replyAnswer, Explanation: "Use du.", OS: "linux", Shell: "bash"},
+		here("list listening ports", "ss -tlnp"),
+	}
+
+	e, score := similarHistory(entries, "Disk usage of current dir sorted", "linux", "bash", "", 0.6)
+	if e == nil || e.Command != "du -sh * | sort -h" || score != 1 {
+		t.Fatalf("got %+v (%.2f)", e, score)
+	}
+	if e, _ := similarHistory(entries, "compress all logs", "linux", "bash", "", 0.6); e != nil {
+		t.Fatalf("unrelated query matched %+v", e)
+	}
+	if e, _ := similarHistory(entries, "disk usage of current dir sorted", "linux", "bash", replyScript, 0.6); e != nil {
+		t.Fatalf("--script matched a single command %+v", e)
+	}
+
+	// The most recent of equally good matches wins.
+	entries = append(entries, here("disk usage of current dir sorted", "du -h -d1 | sort -h"))
+	if e, _ := similarHistory(entries, "disk usage of current dir sorted", "linux", "bash", "", 0.6); e == nil || e.Command != "du -h -d1 | sort -h" {
+		t.Fatalf("expected the newest match, got %+v", e)
+	}
+}
+
+func TestSimilarHistory_RejectsOpposites(t *testing.T) {
+	pairs := [][2]string{
+		{"stop all docker containers", "start all docker containers"},
+		{"mount the usb drive", "unmount the usb drive"},
+		{"enable the firewall", "disable the firewall"},
+		{"compress the logs folder", "decompress the logs folder"},
+		{"list files in this dir", "list files not in this dir"},
+		{"install nginx", "uninstall nginx"},
+	}
+	for _, p := range pairs {
+		entries := []HistoryEntry{{Query: p[0], Command: "true", OS: "linux", Shell: "bash"}}
+		if e, score := similarHistory(entries, p[1], "linux", "bash", "", 0.3); e != nil {
+			t.Errorf("%q matched %q (%.2f)", p[1], p[0], score)
+		}
+	}
+	if !conflictingQueries("stop all docker containers", "start all docker containers") || conflictingQueries("stop all docker containers", "stop every docker container") {
+		t.Fatal("conflictingQueries disagrees with its own rules")
+	}
+}
+
+func TestOfferHistory(t *testing.T) {
+	e := &HistoryEntry{Query: "list listening ports", Command: "ss -tlnp"}
+	for in, want := range map[string]bool{"y\n": true, "YES\n": true, "\n": false, "n\n": false, "": false, "later\n": false} {
+		var out bytes.Buffer
+		if got := offerHistory(strings.NewReader(in), &out, e); got != want {
+			t.Errorf("answer %q: got %v, want %v", in, got, want)
+		}
+		if !strings.Contains(out.String(), "  ss -tlnp\n") {
+			t.Fatalf("command not shown: %q", out.String())
+		}
+	}
+}
+
+func TestReadHistory_SkipsBadLines(t *testing.T) {
+	dir := resetForTest(t)
+	data := `{"query":"a","command":"ls"}` + "\nnot json\n\n" + `{"query":"b","command":"pwd"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "history.jsonl"), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := readHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Command != "pwd" {
+		t.Fatalf("got %+v", entries)
+	}
+}
+
+func TestRoot_ReusesHistoryWithoutAPIKey(t *testing.T) {
+	dir := resetForTest(t)
+	viper.Set("suggest.enabled", true)
+	prev := HistoryEntry{ID: "prev-1", Query: "disk usage of current dir sorted", Command: "du -sh * | sort -h", Provider: providerOpenAI, Model: "gpt-x", OS: runtime.GOOS, Shell: resolveShell(defaultSys).Name}
+	b, err := json.Marshal(prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "history.jsonl"), append(b, '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var offered bytes.Buffer
+	origTerm, origQuery := reuseTerminal, llmQuery
+	t.Cleanup(func() { reuseTerminal, llmQuery = origTerm, origQuery })
+	reuseTerminal = func() (io.Reader, io.Writer, bool) { return strings.NewReader("y\n"), &offered, true }
+	llmQuery = func(req LLMRequest) (LLMResponse, error) {
+		t.Fatal("the model should not be asked")
+		return LLMResponse{}, nil
+	}
+
+	// No API key is configured: reusing a command must not need one.
+	out, err := executeRoot(t, "disk", "usage", "of", "current", "dir", "sorted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "du -sh * | sort -h\n" || !strings.Contains(offered.String(), "Reuse it?") {
+		t.Fatalf("stdout = %q, offer = %q", out, offered.String())
+	}
+	entry, err := readLastHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.ReusedFrom != "prev-1" || entry.Provider != providerOpenAI || entry.Model != "gpt-x" {
+		t.Fatalf("reuse not recorded: %+v", entry)
+	}
+}
+
+func TestSuggestFromHistory_OffByDefault(t *testing.T) {
+	_ = resetForTest(t)
+	appendHistory(HistoryEntry{Query: "list listening ports", Command: "ss -tlnp", OS: runtime.GOOS, Shell: resolveShell(defaultSys).Name})
+	orig := reuseTerminal
+	t.Cleanup(func() { reuseTerminal = orig })
+	reuseTerminal = func() (io.Reader, io.Writer, bool) {
+		t.Fatal("nothing should be offered unless suggest.enabled is set")
+		return nil, nil, false
+	}
+	if e := suggestFromHistory("list listening ports"); e != nil {
+		t.Fatalf("got %+v", e)
+	}
+}
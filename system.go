@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// parseOSRelease parses the KEY=value lines of /etc/os-release.
+func parseOSRelease(b []byte) map[string]string {
+	m := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		m[k] = strings.Trim(v, `"'`)
+	}
+	return m
+}
+
+// detectLinuxEnvironment fills in the distribution, kernel, container and
+// WSL details that tell e.g. Ubuntu 20.04 apart from Alpine inside Docker.
+func detectLinuxEnvironment(sys Sys, info *SystemInfo) {
+	for _, p := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		b, err := sys.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		rel := parseOSRelease(b)
+		info.Distro = rel["PRETTY_NAME"]
+		if info.Distro == "" {
+			info.Distro = strings.TrimSpace(rel["NAME"] + " " + rel["VERSION_ID"])
+		}
+		info.DistroID = rel["ID"]
+		info.DistroLike = strings.Fields(rel["ID_LIKE"])
+		break
+	}
+
+	// Same as `uname -r`.
+	if b, err := sys.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		info.Kernel = strings.TrimSpace(string(b))
+	}
+
+	info.WSL = detectWSL(sys, info.Kernel)
+	info.Container = detectContainer(sys)
+}
+
+func detectWSL(sys Sys, kernel string) string {
+	k := strings.ToLower(kernel)
+	switch {
+	case strings.Contains(k, "wsl2"):
+		return "WSL2"
+	case strings.Contains(k, "microsoft"):
+		// WSL1 kernels report e.g. 4.4.0-19041-Microsoft.
+		if _, err := sys.Stat("/run/WSL"); err == nil {
+			return "WSL2"
+		}
+		return "WSL1"
+	case sys.Env("WSL_DISTRO_NAME") != "" || sys.Env("WSL_INTEROP") != "":
+		return "WSL"
+	}
+	return ""
+}
+
+func detectContainer(sys Sys) string {
+	if _, err := sys.Stat("/.dockerenv"); err == nil {
+		return "docker"
+	}
+	if _, err := sys.Stat("/run/.containerenv"); err == nil {
+		return "podman"
+	}
+	// Set by systemd-nspawn, podman, LXC and friends for PID 1.
+	if c := sys.Env("container"); c != "" {
+		return c
+	}
+	if b, err := sys.ReadFile("/proc/1/cgroup"); err == nil {
+		cg := string(b)
+		switch {
+		case strings.Contains(cg, "kubepods"):
+			return "kubernetes"
+		case strings.Contains(cg, "docker"):
+			return "docker"
+		case strings.Contains(cg, "libpod"):
+			return "podman"
+		case strings.Contains(cg, "containerd"):
+			return "containerd"
+		case strings.Contains(cg, "lxc"):
+			return "lxc"
+		}
+	}
+	if sys.Env("KUBERNETES_SERVICE_HOST") != "" {
+		return "kubernetes"
+	}
+	return ""
+}
@@ -16,6 +16,9 @@ type fakeSys struct {
 	goos  string
 	arch  string
 	files map[string]bool
+	data  map[string]string
+	out   map[string]string
+	ppid  int
 }
 
 func (f fakeSys) Env(k string) string { return f.env[k] }
@@ -34,11 +37,25 @@ func (f fakeSys) CurrentUser() (*user.User, error) {
 func (f fakeSys) GOOS() string   { return f.goos }
 func (f fakeSys) GOARCH() string { return f.arch }
 func (f fakeSys) Stat(name string) (os.FileInfo, error) {
-	if f.files[name] {
+	if _, ok := f.data[name]; ok || f.files[name] {
 		return fakeFileInfo{name: name}, nil
 	}
 	return nil, errors.New("no")
 }
+func (f fakeSys) ReadFile(name string) ([]byte, error) {
+	if d, ok := f.data[name]; ok {
+		return []byte(d), nil
+	}
+	return nil, errors.New("no")
+}
+
+func (f fakeSys) Getppid() int { return f.ppid }
+func (f fakeSys) Output(name string, args ...string) ([]byte, error) {
+	if o, ok := f.out[strings.Join(append([]string{name}, args...), " ")]; ok {
+		return []byte(o), nil
+	}
+	return nil, errors.New("no")
+}
 
 type fakeFileInfo struct{ name string }
 
@@ -74,6 +91,62 @@ func TestDetectUserPrivileges_WindowsAdmin(t *testing.T) {
 	}
 }
 
+func TestGetSystemInfo_UbuntuInDocker(t *testing.T) {
+	fs := fakeSys{
+		env:   map[string]string{"SHELL": "/bin/bash"},
+		goos:  "linux",
+		arch:  "amd64",
+		files: map[string]bool{"/.dockerenv": true},
+		data: map[string]string{
+			"/etc/os-release":            "NAME=\"Ubuntu\"\nVERSION_ID=\"20.04\"\nID=ubuntu\nID_LIKE=debian\nPRETTY_NAME=\"Ubuntu 20.04.6 LTS\"\n",
+			"/proc/sys/kernel/osrelease": "5.15.0-91-generic\n",
+		},
+	}
+	info := collectSystemInfo(fs)
+	if info.DistroID != "ubuntu" || len(info.DistroLike) != 1 || info.DistroLike[0] != "debian" {
+		t.Fatalf("unexpected distro: %#v", info)
+	}
+	if !containsAll(info.String(), []string{"- Distribution: Ubuntu 20.04.6 LTS", "- Kernel: 5.15.0-91-generic", "- Container: docker"}) {
+		t.Fatalf("unexpected info: %s", info)
+	}
+	if strings.Contains(info.String(), "WSL") {
+		t.Fatalf("unexpected WSL line: %s", info)
+	}
+}
+
+func TestGetSystemInfo_AlpineWithoutPrettyName(t *testing.T) {
+	fs := fakeSys{
+		goos: "linux",
+		arch: "arm64",
+		data: map[string]string{
+			"/etc/os-release": "NAME=\"Alpine Linux\"\nID=alpine\nVERSION_ID=3.19.1\n",
+			"/proc/1/cgroup":  "0::/kubepods/besteffort/pod1234/abcd\n",
+		},
+	}
+	info := getSystemInfoWith(fs)
+	if !containsAll(info, []string{"- Distribution: Alpine Linux 3.19.1", "- Container: kubernetes"}) {
+		t.Fatalf("unexpected info: %s", info)
+	}
+}
+
+func TestDetectWSL(t *testing.T) {
+	cases := []struct {
+		kernel string
+		sys    fakeSys
+		want   string
+	}{
+		{"5.15.133.1-microsoft-standard-WSL2", fakeSys{}, "WSL2"},
+		{"4.4.0-19041-Microsoft", fakeSys{}, "WSL1"},
+		{"6.1.0", fakeSys{env: map[string]string{"WSL_DISTRO_NAME": "Debian"}}, "WSL"},
+		{"6.1.0", fakeSys{}, ""},
+	}
+	for _, c := range cases {
+		if got := detectWSL(c.sys, c.kernel); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.kernel, got, c.want)
+		}
+	}
+}
+
 func containsAll(s string, parts []string) bool {
 	for _, p := range parts {
 		if !strings.Contains(s, p) {
@@ -82,3 +155,50 @@ func containsAll(s string, parts []string) bool {
 	}
 	return true
 }
+
+func TestDetectPackageManagers_Ranking(t *testing.T) {
+	tests := []struct {
+		name    string
+		goos    string
+		distros []string
+		look    []string
+		want    string
+		primary string
+	}{
+		{"ubuntu", "linux", []string{"ubuntu", "debian"}, []string{"snap", "brew", "apt", "flatpak"}, "apt (Debian), Homebrew, Snap, Flatpak", "apt (Debian)"},
+		{"fedora", "linux", []string{"fedora"}, []string{"yum", "dnf", "flatpak"}, "dnf (Fedora), yum (RHEL), Flatpak", "dnf (Fedora)"},
+		{"rocky via ID_LIKE", "linux", []string{"rocky", "rhel", "centos", "fedora"}, []string{"yum", "dnf"}, "dnf (Fedora), yum (RHEL)", "dnf (Fedora)"},
+		{"arch with apt installed", "linux", []string{"arch"}, []string{"apt", "pacman"}, "pacman (Arch), apt (Debian)", "pacman (Arch)"},
+		{"macos", "darwin", []string{""}, []string{"nix", "port", "brew"}, "Homebrew, MacPorts, Nix", "Homebrew"},
+		{"windows", "windows", []string{""}, []string{"scoop", "choco", "winget"}, "winget, Chocolatey, Scoop", "winget"},
+		{"only universal", "linux", []string{"nixos"}, []string{"nix"}, "Nix", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			look := map[string]bool{}
+			for _, l := range tt.look {
+				look[l] = true
+			}
+			// Repeat to catch any dependence on map iteration order.
+			for i := 0; i < 20; i++ {
+				got, primary := detectPackageManagersWith(fakeSys{goos: tt.goos, look: look}, tt.distros)
+				if strings.Join(got, ", ") != tt.want || primary != tt.primary {
+					t.Fatalf("got %v (primary %q), want %s (primary %q)", got, primary, tt.want, tt.primary)
+				}
+			}
+		})
+	}
+}
+
+func TestGetSystemInfo_PrimaryPackageManager(t *testing.T) {
+	fs := fakeSys{
+		goos: "linux",
+		arch: "amd64",
+		look: map[string]bool{"apt": true, "snap": true},
+		data: map[string]string{"/etc/os-release": "ID=ubuntu\nID_LIKE=debian\nPRETTY_NAME=\"Ubuntu 24.04 LTS\"\n"},
+	}
+	info := getSystemInfoWith(fs)
+	if !containsAll(info, []string{"- Package Managers: apt (Debian), Snap", "- Primary Package Manager: apt (Debian)"}) {
+		t.Fatalf("unexpected info: %s", info)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const defaultToolsCacheHours = 24
+
+// Tool is an installed command line tool. Command is set when the tool is
+// installed under another name, e.g. fd as fdfind on Debian.
+type Tool struct {
+	Name    string `json:"name"`
+	Command string `json:"command,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+func (t Tool) String() string {
+	s := t.Name
+	if t.Version != "" {
+		s += " " + t.Version
+	}
+	if t.Command != "" && t.Command != t.Name {
+		s += " (run as " + t.Command + ")"
+	}
+	return s
+}
+
+type toolSpec struct {
+	Name        string
+	Commands    []string
+	VersionArgs []string
+	// OS limits the tool to the GOOS values it makes sense on; a missing
+	// launchctl is not worth mentioning on Linux.
+	OS []string
+}
+
+// knownTools is the curated list of tools the model tends to assume exist.
+var knownTools = []toolSpec{
+	{Name: "git", VersionArgs: []string{"--version"}},
+	{Name: "curl", VersionArgs: []string{"--version"}},
+	{Name: "wget", VersionArgs: []string{"--version"}},
+	{Name: "jq", VersionArgs: []string{"--version"}},
+	{Name: "yq", VersionArgs: []string{"--version"}},
+	{Name: "rg", VersionArgs: []string{"--version"}},
+	{Name: "fd", Commands: []string{"fd", "fdfind"}, VersionArgs: []string{"--version"}},
+	{Name: "docker", VersionArgs: []string{"--version"}},
+	{Name: "podman", VersionArgs: []string{"--version"}},
+	{Name: "kubectl", VersionArgs: []string{"version", "--client"}},
+	{Name: "systemctl", VersionArgs: []string{"--version"}, OS: []string{"linux"}},
+	{Name: "launchctl", OS: []string{"darwin"}},
+}
+
+// ToolInventory is what the tool detector found.
+type ToolInventory struct {
+	Userland []string `json:"userland,omitempty"`
+	Tools    []Tool   `json:"tools,omitempty"`
+	Missing  []string `json:"missing,omitempty"`
+}
+
+type toolCache struct {
+	Created time.Time `json:"created"`
+	Key     string    `json:"key"`
+	ToolInventory
+}
+
+var versionRe = regexp.MustCompile(`\d+(\.\d+)*`)
+
+// probeVersion returns the first version-looking number in the first line
+// of `cmd args`, e.g. 2.43.0 from "git version 2.43.0".
+func probeVersion(sys Sys, cmd string, args []string) string {
+	out, err := sys.Output(cmd, args...)
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return versionRe.FindString(line)
+}
+
+func isBSDLike(goos string) bool {
+	switch goos {
+	case "darwin", "freebsd", "openbsd", "netbsd", "dragonfly":
+		return true
+	}
+	return false
+}
+
+// userlandFlavor tells GNU, BusyBox and BSD variants of cmd apart, since
+// their flags differ (sed -i, date -d, stat -c, ...). BSD tools reject
+// --version, so that is assumed when the probe says nothing useful on a
+// BSD-like OS.
+func userlandFlavor(sys Sys, cmd, label string) string {
+	if _, err := sys.LookPath(cmd); err != nil {
+		return ""
+	}
+	// BusyBox prints its banner along with an error, so keep the output.
+	out, _ := sys.Output(cmd, "--version")
+	s := string(out)
+	switch {
+	case strings.Contains(s, "GNU"):
+		return "GNU " + label
+	case strings.Contains(s, "BusyBox"):
+		return "BusyBox " + label
+	case strings.Contains(s, "uutils"):
+		return "uutils " + label
+	case strings.Contains(s, "mawk"):
+		return "mawk"
+	}
+	if isBSDLike(sys.GOOS()) {
+		return "BSD " + label
+	}
+	return ""
+}
+
+// detectToolsWith looks up knownTools and the userland flavor. Versions
+// are only probed when versions is set, as that runs one process per tool.
+func detectToolsWith(sys Sys, versions bool) ToolInventory {
+	var inv ToolInventory
+	if sys.GOOS() != "windows" {
+		for _, u := range [][2]string{{"ls", "coreutils"}, {"sed", "sed"}, {"awk", "awk"}} {
+			if f := userlandFlavor(sys, u[0], u[1]); f != "" {
+				inv.Userland = append(inv.Userland, f)
+			}
+		}
+	}
+
+	for _, spec := range knownTools {
+		if len(spec.OS) > 0 && !contains(spec.OS, sys.GOOS()) {
+			continue
+		}
+		commands := spec.Commands
+		if len(commands) == 0 {
+			commands = []string{spec.Name}
+		}
+		found := false
+		for _, c := range commands {
+			if _, err := sys.LookPath(c); err != nil {
+				continue
+			}
+			t := Tool{Name: spec.Name, Command: c}
+			if versions && len(spec.VersionArgs) > 0 {
+				t.Version = probeVersion(sys, c, spec.VersionArgs)
+			}
+			inv.Tools = append(inv.Tools, t)
+			found = true
+			break
+		}
+		if !found {
+			inv.Missing = append(inv.Missing, spec.Name)
+		}
+	}
+	return inv
+}
+
+func toolsCachePath() (string, error) {
+	dir, err := howConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tools.json"), nil
+}
+
+// toolsCacheKey changes whenever the result could: a different PATH or a
+// different version probing setting.
+func toolsCacheKey(sys Sys, versions bool) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%t", sys.GOOS(), sys.Env("PATH"), versions)))
+	return hex.EncodeToString(sum[:])
+}
+
+// toolInventoryWith returns the cached inventory while it is younger than
+// tools.cache_hours, and detects and caches it otherwise.
+func toolInventoryWith(sys Sys) ToolInventory {
+	versions := viper.GetBool("tools.versions")
+	ttl := time.Duration(viper.GetInt("tools.cache_hours")) * time.Hour
+	if ttl <= 0 {
+		return detectToolsWith(sys, versions)
+	}
+
+	key := toolsCacheKey(sys, versions)
+	path, err := toolsCachePath()
+	if err != nil {
+		return detectToolsWith(sys, versions)
+	}
+	var cache toolCache
+	if b, err := os.ReadFile(path); err == nil && json.Unmarshal(b, &cache) == nil {
+		if cache.Key == key && time.Since(cache.Created) < ttl {
+			return cache.ToolInventory
+		}
+	}
+
+	cache = toolCache{Created: time.Now(), Key: key, ToolInventory: detectToolsWith(sys, versions)}
+	// Best-effort: a read-only config dir only costs the next run a re-probe.
+	if b, err := json.MarshalIndent(cache, "", "  "); err == nil {
+		_ = os.WriteFile(path, b, 0600)
+	}
+	return cache.ToolInventory
+}
+
+// currentSystemInfo describes this machine, including its tools when
+// tools.detect is on.
+func currentSystemInfo() SystemInfo {
+	info := collectSystemInfo(defaultSys)
+	if viper.GetBool("tools.detect") {
+		inv := toolInventoryWith(defaultSys)
+		info.Userland = inv.Userland
+		info.Tools = inv.Tools
+		info.MissingTools = inv.Missing
+	}
+	return info
+}
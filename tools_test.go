@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestDetectToolsGNULinux(t *testing.T) {
+	fs := fakeSys{
+		goos: "linux",
+		look: map[string]bool{"ls": true, "sed": true, "awk": true, "git": true, "fdfind": true, "kubectl": true, "systemctl": true},
+		out: map[string]string{
+			"ls --version":             "ls (GNU coreutils) 9.4\n",
+			"sed --version":            "sed (GNU sed) 4.9\n",
+			"awk --version":            "mawk 1.3.4 20240123\n",
+			"git --version":            "git version 2.43.0\n",
+			"fdfind --version":         "fdfind 9.0.0\n",
+			"kubectl version --client": "Client Version: v1.30.2\nKustomize Version: v5.0.4\n",
+			"systemctl --version":      "systemd 255 (255.4-1ubuntu8)\n+PAM +AUDIT\n",
+		},
+	}
+
+	inv := detectToolsWith(fs, true)
+	if want := []string{"GNU coreutils", "GNU sed", "mawk"}; !reflect.DeepEqual(inv.Userland, want) {
+		t.Fatalf("userland = %v, want %v", inv.Userland, want)
+	}
+	want := []Tool{
+		{Name: "git", Command: "git", Version: "2.43.0"},
+		{Name: "fd", Command: "fdfind", Version: "9.0.0"},
+		{Name: "kubectl", Command: "kubectl", Version: "1.30.2"},
+		{Name: "systemctl", Command: "systemctl", Version: "255"},
+	}
+	if !reflect.DeepEqual(inv.Tools, want) {
+		t.Fatalf("tools = %+v, want %+v", inv.Tools, want)
+	}
+	if want := []string{"curl", "wget", "jq", "yq", "rg", "docker", "podman"}; !reflect.DeepEqual(inv.Missing, want) {
+		t.Fatalf("missing = %v, want %v", inv.Missing, want)
+	}
+	if got := inv.Tools[1].String(); got != "fd 9.0.0 (run as fdfind)" {
+		t.Fatalf("fd renders as %q", got)
+	}
+}
+
+func TestDetectToolsBSDWithoutVersions(t *testing.T) {
+	fs := fakeSys{
+		goos: "darwin",
+		look: map[string]bool{"ls": true, "sed": true, "awk": true, "jq": true, "launchctl": true},
+		out:  map[string]string{"jq --version": "jq-1.7.1"},
+	}
+
+	inv := detectToolsWith(fs, false)
+	if want := []string{"BSD coreutils", "BSD sed", "BSD awk"}; !reflect.DeepEqual(inv.Userland, want) {
+		t.Fatalf("userland = %v, want %v", inv.Userland, want)
+	}
+	want := []Tool{{Name: "jq", Command: "jq"}, {Name: "launchctl", Command: "launchctl"}}
+	if !reflect.DeepEqual(inv.Tools, want) {
+		t.Fatalf("tools = %+v, want %+v", inv.Tools, want)
+	}
+	for _, m := range inv.Missing {
+		if m == "systemctl" {
+			t.Fatal("systemctl should not be reported missing on macOS")
+		}
+	}
+}
+
+func TestToolInventoryCache(t *testing.T) {
+	_ = resetForTest(t)
+	fs := fakeSys{goos: "linux", env: map[string]string{"PATH": "/bin"}, look: map[string]bool{"rg": true}}
+
+	first := toolInventoryWith(fs)
+	if len(first.Tools) != 1 || first.Tools[0].Name != "rg" {
+		t.Fatalf("tools = %+v", first.Tools)
+	}
+
+	// Within the TTL the cached result is used even though jq appeared.
+	fs.look["jq"] = true
+	if got := toolInventoryWith(fs); !reflect.DeepEqual(got, first) {
+		t.Fatalf("expected cached inventory, got %+v", got)
+	}
+
+	// A different PATH invalidates the cache.
+	fs.env = map[string]string{"PATH": "/bin:/usr/local/bin"}
+	if got := toolInventoryWith(fs); len(got.Tools) != 2 {
+		t.Fatalf("expected re-detection after PATH change, got %+v", got.Tools)
+	}
+
+	viper.Set("tools.cache_hours", 0)
+	delete(fs.look, "rg")
+	if got := toolInventoryWith(fs); len(got.Tools) != 1 || got.Tools[0].Name != "jq" {
+		t.Fatalf("expected no caching with cache_hours 0, got %+v", got.Tools)
+	}
+}
+
+func TestSystemInfoListsTools(t *testing.T) {
+	info := SystemInfo{
+		OS:           "Linux",
+		Arch:         "amd64",
+		Userland:     []string{"GNU coreutils"},
+		Tools:        []Tool{{Name: "git", Version: "2.43.0"}},
+		MissingTools: []string{"rg", "fd"},
+	}
+	s := info.String()
+	for _, want := range []string{"- Userland: GNU coreutils", "- Installed Tools: git 2.43.0", "- Not Installed: rg, fd"} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("missing %q in:\n%s", want, s)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultUndoMaxMB = 100
+	maxSnapshots     = 20
+)
+
+type Snapshot struct {
+	ID        string          `json:"id"`
+	HistoryID string          `json:"history_id,omitempty"`
+	Command   string          `json:"command"`
+	Created   time.Time       `json:"created"`
+	Entries   []SnapshotEntry `json:"entries"`
+}
+
+type SnapshotEntry struct {
+	Path   string `json:"path"`
+	Stored string `json:"stored,omitempty"`
+	// Missing marks a path that did not exist before the command ran;
+	// restoring removes whatever the command created there.
+	Missing bool `json:"missing,omitempty"`
+}
+
+var (
+	undoListFlag bool
+
+	undoCmd = &cobra.Command{
+		Use:   "undo [id]",
+		Short: "Restore files changed by a command run with --run",
+		Long: "Restore the files and directories that were snapshotted before a command was run with --run.\n" +
+			"Without an id the most recent snapshot is restored. The id may be a snapshot id or a history id.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: runUndo,
+	}
+)
+
+func newID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+func snapshotsDir() (string, error) {
+	dir, err := howConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "snapshots"), nil
+}
+
+func undoMaxBytes() int64 {
+	mb := int64(defaultUndoMaxMB)
+	if viper.IsSet("undo_max_mb") {
+		mb = viper.GetInt64("undo_max_mb")
+	}
+	return mb << 20
+}
+
+// treeSize returns the total size of the regular files under path.
+func treeSize(path string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += fi.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// takeSnapshot copies paths into a new snapshot so that `how undo` can
+// restore them. Snapshots larger than the configured limit are refused.
+func takeSnapshot(historyID, command string, paths []string) (*Snapshot, error) {
+	limit := undoMaxBytes()
+	var total int64
+	for _, p := range paths {
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			continue
+		}
+		n, err := treeSize(p)
+		if err != nil {
+			return nil, err
+		}
+		total += n
+		if total > limit {
+			return nil, fmt.Errorf("%s exceeds the undo size limit of %d MB", p, limit>>20)
+		}
+	}
+
+	root, err := snapshotsDir()
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{ID: newID(), HistoryID: historyID, Command: command, Created: time.Now()}
+	dir := filepath.Join(root, s.ID)
+	if err := os.MkdirAll(filepath.Join(dir, "files"), 0700); err != nil {
+		return nil, err
+	}
+
+	for i, p := range paths {
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			s.Entries = append(s.Entries, SnapshotEntry{Path: p, Missing: true})
+			continue
+		}
+		stored := strconv.Itoa(i)
+		if err := copyTree(p, filepath.Join(dir, "files", stored)); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+		s.Entries = append(s.Entries, SnapshotEntry{Path: p, Stored: stored})
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), b, 0600); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	pruneSnapshots(root)
+	return s, nil
+}
+
+// copyTree copies src to dst, preserving modes and symlinks.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, fi.Mode().Perm()|0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(p, target, fi.Mode().Perm())
+		}
+		// Sockets, devices and pipes cannot be restored meaningfully.
+		return nil
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// listSnapshots returns all readable snapshots, newest first.
+func listSnapshots() ([]*Snapshot, error) {
+	root, err := snapshotsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var out []*Snapshot
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(root, e.Name(), "manifest.json"))
+		if err != nil {
+			continue
+		}
+		var s Snapshot
+		if err := json.Unmarshal(b, &s); err != nil {
+			continue
+		}
+		out = append(out, &s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out, nil
+}
+
+func pruneSnapshots(root string) {
+	snaps, err := listSnapshots()
+	if err != nil || len(snaps) <= maxSnapshots {
+		return
+	}
+	for _, s := range snaps[maxSnapshots:] {
+		_ = os.RemoveAll(filepath.Join(root, s.ID))
+	}
+}
+
+// findSnapshot returns the newest snapshot matching id, which may be either a
+// snapshot id or the id of the history entry it was taken for.
+func findSnapshot(id string) (*Snapshot, error) {
+	snaps, err := listSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range snaps {
+		if id == "" || s.ID == id || s.HistoryID == id {
+			return s, nil
+		}
+	}
+	if id == "" {
+		return nil, fmt.Errorf("nothing to undo")
+	}
+	return nil, fmt.Errorf("no snapshot found for %q", id)
+}
+
+// restoreSnapshot puts every snapshotted path back in place, removes the
+// paths the command created and removes the snapshot.
+func restoreSnapshot(s *Snapshot) error {
+	root, err := snapshotsDir()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(root, s.ID)
+	for _, e := range s.Entries {
+		if err := os.RemoveAll(e.Path); err != nil {
+			return err
+		}
+		if e.Missing {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(e.Path), 0755); err != nil {
+			return err
+		}
+		if err := copyTree(filepath.Join(dir, "files", e.Stored), e.Path); err != nil {
+			return fmt.Errorf("restore %s: %w", e.Path, err)
+		}
+	}
+	return os.RemoveAll(dir)
+}
+
+// executeWithSnapshot snapshots the paths a command is expected to touch and
+// then runs it.
+func executeWithSnapshot(command string, entry HistoryEntry) error {
+	snapshotTouched(command, entry)
+	return executeShellCommand(command)
+}
+
+// snapshotTouched snapshots the paths command is expected to touch. The
+// snapshot records the history entry's (redacted) command. A failed
+// snapshot only costs the ability to undo, so it is reported but does not
+// stop the command.
+func snapshotTouched(command string, entry HistoryEntry) {
+	if paths := touchedPaths(command); len(paths) > 0 {
+		s, err := takeSnapshot(entry.ID, entry.Command, paths)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Snapshot skipped, this command cannot be undone: %v\n", err)
+		} else if debug {
+			fmt.Fprintf(os.Stderr, "Snapshot %s: %s\n", s.ID, strings.Join(paths, ", "))
+		}
+	}
+}
+
+func runUndo(cmd *cobra.Command, args []string) error {
+	if undoListFlag {
+		snaps, err := listSnapshots()
+		if err != nil {
+			return err
+		}
+		for _, s := range snaps {
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s  %s  %s\n", s.ID, s.Created.Format(time.DateTime), s.Command)
+		}
+		return nil
+	}
+
+	var id string
+	if len(args) > 0 {
+		id = args[0]
+	}
+	s, err := findSnapshot(id)
+	if err != nil {
+		return err
+	}
+
+	var restored, removed []string
+	for _, e := range s.Entries {
+		if e.Missing {
+			removed = append(removed, e.Path)
+		} else {
+			restored = append(restored, e.Path)
+		}
+	}
+	detail := s.Command
+	if len(restored) > 0 {
+		detail += fmt.Sprintf("\n(restores %s)", strings.Join(restored, ", "))
+	}
+	if len(removed) > 0 {
+		detail += fmt.Sprintf("\n(removes %s, created by the command)", strings.Join(removed, ", "))
+	}
+	if err := confirm("Undo this command?", detail); err != nil {
+		return err
+	}
+	if err := restoreSnapshot(s); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "✅ Restored %d path(s) from snapshot %s\n", len(s.Entries), s.ID)
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSnapshot_RestoreRoundTrip(t *testing.T) {
+	_ = resetForTest(t)
+	yesFlag = true
+
+	work := t.TempDir()
+	file := filepath.Join(work, "notes.txt")
+	sub := filepath.Join(work, "data")
+	if err := os.WriteFile(file, []byte("original"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(sub, "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "nested", "x"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := takeSnapshot("hist-1", "rm -rf data notes.txt", []string{file, sub})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate the command.
+	if err := os.RemoveAll(sub); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("changed"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := executeRoot(t, "undo", "hist-1"); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil || string(b) != "original" {
+		t.Fatalf("file not restored: %q %v", b, err)
+	}
+	if fi, err := os.Stat(file); err != nil || fi.Mode().Perm() != 0640 {
+		t.Fatalf("mode not restored: %v %v", fi.Mode(), err)
+	}
+	if _, err := os.Stat(filepath.Join(sub, "nested", "x")); err != nil {
+		t.Fatalf("directory not restored: %v", err)
+	}
+	if _, err := findSnapshot(s.ID); err == nil {
+		t.Fatal("expected snapshot to be removed after restore")
+	}
+}
+
+func TestSnapshot_RestoreRemovesCreatedPaths(t *testing.T) {
+	for _, mv := range []string{"mv", "mv -n"} {
+		_ = resetForTest(t)
+		yesFlag = true
+
+		work := t.TempDir()
+		src := filepath.Join(work, "a.txt")
+		dst := filepath.Join(work, "b.txt")
+		if err := os.WriteFile(src, []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		command := mv + " " + src + " " + dst
+		if _, err := takeSnapshot("hist-mv", command, touchedPaths(command)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(src, dst); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := executeRoot(t, "undo", "hist-mv"); err != nil {
+			t.Fatalf("%s: undo failed: %v", mv, err)
+		}
+		if b, err := os.ReadFile(src); err != nil || string(b) != "a" {
+			t.Fatalf("%s: source not restored: %q %v", mv, b, err)
+		}
+		if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+			t.Fatalf("%s: created file left behind: %v", mv, err)
+		}
+	}
+}
+
+func TestSnapshot_RestoresRecursivelyRemovedDir(t *testing.T) {
+	_ = resetForTest(t)
+	yesFlag = true
+
+	build := filepath.Join(t.TempDir(), "build")
+	if err := os.MkdirAll(filepath.Join(build, "obj"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(build, "obj", "main.o"), []byte("o"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	command := "rm -r " + build
+	if _, err := takeSnapshot("hist-rm", command, touchedPaths(command)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(build); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := executeRoot(t, "undo", "hist-rm"); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(build, "obj", "main.o")); err != nil || string(b) != "o" {
+		t.Fatalf("directory not restored: %q %v", b, err)
+	}
+}
+
+func TestSnapshot_RefusesOverSizeLimit(t *testing.T) {
+	_ = resetForTest(t)
+	viper.Set("undo_max_mb", 1)
+
+	big := filepath.Join(t.TempDir(), "big.bin")
+	if err := os.WriteFile(big, make([]byte, 2<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := takeSnapshot("", "rm big.bin", []string{big})
+	if err == nil || !strings.Contains(err.Error(), "undo size limit") {
+		t.Fatalf("expected size limit error, got: %v", err)
+	}
+	if snaps, _ := listSnapshots(); len(snaps) != 0 {
+		t.Fatalf("expected no snapshots, got %d", len(snaps))
+	}
+}
+
+func TestUndo_NothingToUndo(t *testing.T) {
+	_ = resetForTest(t)
+
+	_, err := executeRoot(t, "undo")
+	if err == nil || !strings.Contains(err.Error(), "nothing to undo") {
+		t.Fatalf("expected nothing to undo error, got: %v", err)
+	}
+}
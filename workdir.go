@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultContextMaxFiles = 40
+	defaultContextMaxBytes = 2000
+	// maxTargets bounds the npm scripts and make/just targets listed.
+	maxTargets = 15
+)
+
+var noContextFlag bool
+
+// projectMarker is a file whose presence says what kind of project the
+// directory is and therefore how to build or test it.
+type projectMarker struct {
+	File string
+	Kind string
+}
+
+var projectMarkers = []projectMarker{
+	{"go.mod", "Go module"},
+	{"package.json", "Node.js package"},
+	{"pnpm-lock.yaml", "pnpm lockfile"},
+	{"yarn.lock", "Yarn lockfile"},
+	{"bun.lockb", "Bun lockfile"},
+	{"Cargo.toml", "Rust crate"},
+	{"pyproject.toml", "Python project"},
+	{"requirements.txt", "Python requirements"},
+	{"Gemfile", "Ruby bundle"},
+	{"pom.xml", "Maven project"},
+	{"build.gradle", "Gradle project"},
+	{"build.gradle.kts", "Gradle project"},
+	{"CMakeLists.txt", "CMake project"},
+	{"Makefile", "Makefile"},
+	{"justfile", "justfile"},
+	{"Dockerfile", "Dockerfile"},
+	{"docker-compose.yml", "Docker Compose"},
+	{"docker-compose.yaml", "Docker Compose"},
+	{"compose.yml", "Docker Compose"},
+	{"compose.yaml", "Docker Compose"},
+}
+
+// contextEnabled reports whether the working directory should be described
+// in the prompt. It is opt-in since it sends file names to the provider.
+func contextEnabled() bool {
+	return viper.GetBool("context.enabled") && !noContextFlag
+}
+
+// tildePath shows dir relative to home as ~/..., leaving paths outside home
+// (including siblings such as /home/bob2 for /home/bob) as they are.
+func tildePath(dir, home string) string {
+	if home == "" {
+		return dir
+	}
+	if dir == home {
+		return "~"
+	}
+	if rest, ok := strings.CutPrefix(dir, strings.TrimSuffix(home, string(filepath.Separator))+string(filepath.Separator)); ok {
+		return "~" + string(filepath.Separator) + rest
+	}
+	return dir
+}
+
+// collectDirContext summarizes dir for the prompt: git state, project
+// markers with their scripts or targets, and a shallow file listing, cut
+// to context.max_bytes.
+func collectDirContext(sys Sys, dir string) string {
+	var lines []string
+
+	home, _ := os.UserHomeDir()
+	lines = append(lines, "- Path: "+tildePath(dir, home))
+
+	if g := gitState(sys, dir); g != "" {
+		lines = append(lines, "- Git: "+g)
+	}
+
+	var kinds []string
+	for _, m := range projectMarkers {
+		if fi, err := os.Stat(filepath.Join(dir, m.File)); err == nil && !fi.IsDir() {
+			kinds = append(kinds, fmt.Sprintf("%s (%s)", m.Kind, m.File))
+		}
+	}
+	if len(kinds) > 0 {
+		lines = append(lines, "- Project: "+strings.Join(kinds, ", "))
+	}
+	if s := npmScripts(filepath.Join(dir, "package.json")); len(s) > 0 {
+		lines = append(lines, "- npm scripts: "+strings.Join(s, ", "))
+	}
+	if t := makeTargets(filepath.Join(dir, "Makefile"), makeTargetRe); len(t) > 0 {
+		lines = append(lines, "- make targets: "+strings.Join(t, ", "))
+	}
+	if t := makeTargets(filepath.Join(dir, "justfile"), justRecipeRe); len(t) > 0 {
+		lines = append(lines, "- just recipes: "+strings.Join(t, ", "))
+	}
+
+	if files := listDir(dir, viper.GetInt("context.max_files")); files != "" {
+		lines = append(lines, "- Files: "+files)
+	}
+
+	out := strings.Join(lines, "\n")
+	if limit := viper.GetInt("context.max_bytes"); limit > 0 && len(out) > limit {
+		out = strings.ToValidUTF8(out[:limit], "") + " ..."
+	}
+	return out
+}
+
+// gitState describes the branch and whether the work tree is dirty, or
+// returns "" outside a repository or without git.
+func gitState(sys Sys, dir string) string {
+	if _, err := sys.LookPath("git"); err != nil {
+		return ""
+	}
+	out, err := sys.Output("git", "-C", dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return ""
+	}
+	branch := strings.TrimSpace(string(out))
+	if branch == "HEAD" {
+		branch = "detached HEAD"
+	} else {
+		branch = "branch " + branch
+	}
+
+	out, err = sys.Output("git", "-C", dir, "status", "--porcelain")
+	if err != nil {
+		return "repository, " + branch
+	}
+	changed := 0
+	for _, l := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(l) != "" {
+			changed++
+		}
+	}
+	if changed == 0 {
+		return "repository, " + branch + ", clean"
+	}
+	return fmt.Sprintf("repository, %s, %d changed files", branch, changed)
+}
+
+func npmScripts(path string) []string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if json.Unmarshal(b, &pkg) != nil {
+		return nil
+	}
+	var names []string
+	for name := range pkg.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return limitList(names, maxTargets)
+}
+
+var (
+	makeTargetRe = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_.-]*)\s*:([^=]|$)`)
+	justRecipeRe = regexp.MustCompile(`^@?([A-Za-z0-9][A-Za-z0-9_-]*)[^:=]*:([^=]|$)`)
+)
+
+// makeTargets returns the rule names at the start of lines in a Makefile or
+// justfile, in file order.
+func makeTargets(path string, re *regexp.Regexp) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+
+	var targets []string
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		m := re.FindStringSubmatch(sc.Text())
+		if m == nil || seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		targets = append(targets, m[1])
+	}
+	return limitList(targets, maxTargets)
+}
+
+// listDir lists the non-hidden entries of dir, directories with a trailing
+// slash, up to max entries.
+func listDir(dir string, max int) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	var names []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(limitList(names, max), ", ")
+}
+
+func limitList(items []string, max int) []string {
+	if max <= 0 || len(items) <= max {
+		return items
+	}
+	return append(items[:max:max], fmt.Sprintf("... and %d more", len(items)-max))
+}
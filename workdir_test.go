@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectDirContext(t *testing.T) {
+	_ = resetForTest(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":       "module example\n",
+		"package.json": `{"scripts": {"test": "vitest", "build": "vite build"}}`,
+		"Makefile":     ".PHONY: test\nGO := go\ntest: build\n\t$(GO) test ./...\nbuild:\n\t$(GO) build\n%.o: %.c\n",
+		"justfile":     "set shell := [\"bash\", \"-c\"]\nlint:\n\tgolangci-lint run\nrelease version:\n\t./release {{version}}\n",
+		"main.go":      "package main\n",
+		".env":         "SECRET=1\n",
+		"cmd/how.go":   "package cmd\n",
+	})
+	fs := fakeSys{
+		look: map[string]bool{"git": true},
+		out: map[string]string{
+			"git -C " + dir + " rev-parse --abbrev-ref HEAD": "feature/x\n",
+			"git -C " + dir + " status --porcelain":          " M main.go\n?? new.txt\n",
+		},
+	}
+
+	got := collectDirContext(fs, dir)
+	for _, want := range []string{
+		"- Git: repository, branch feature/x, 2 changed files",
+		"- Project: Go module (go.mod), Node.js package (package.json), Makefile (Makefile), justfile (justfile)",
+		"- npm scripts: build, test",
+		"- make targets: test, build",
+		"- just recipes: lint, release",
+		"- Files: Makefile, cmd/, go.mod, justfile, main.go, package.json",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, ".env") {
+		t.Errorf("hidden files should not be listed:\n%s", got)
+	}
+}
+
+func TestTildePath(t *testing.T) {
+	home := filepath.Join(string(filepath.Separator), "home", "bob")
+	for dir, want := range map[string]string{
+		home:                           "~",
+		filepath.Join(home, "src"):     filepath.Join("~", "src"),
+		filepath.Join(home+"2", "src"): filepath.Join(home+"2", "src"),
+		filepath.Join(string(filepath.Separator), "tmp"): filepath.Join(string(filepath.Separator), "tmp"),
+	} {
+		if got := tildePath(dir, home); got != want {
+			t.Errorf("tildePath(%q) = %q, want %q", dir, got, want)
+		}
+	}
+}
+
+func TestCollectDirContext_Limits(t *testing.T) {
+	_ = resetForTest(t)
+	dir := t.TempDir()
+	files := map[string]string{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		files[name+".txt"] = ""
+	}
+	writeFiles(t, dir, files)
+
+	viper.Set("context.max_files", 2)
+	got := collectDirContext(fakeSys{}, dir)
+	if !strings.Contains(got, "- Files: a.txt, b.txt, ... and 3 more") {
+		t.Fatalf("file listing not limited:\n%s", got)
+	}
+	if strings.Contains(got, "- Git:") {
+		t.Fatalf("no git without git installed:\n%s", got)
+	}
+
+	viper.Set("context.max_bytes", 20)
+	if got := collectDirContext(fakeSys{}, dir); len(got) > 24 {
+		t.Fatalf("context not truncated: %q", got)
+	}
+}
+
+func TestBuildSystemPrompt_Context(t *testing.T) {
+	_ = resetForTest(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"Cargo.toml": "[package]\n"})
+	t.Chdir(dir)
+
+	prompt, err := buildSystemPrompt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(prompt, "Current directory:") {
+		t.Fatal("directory context must be opt-in")
+	}
+
+	viper.Set("context.enabled", true)
+	prompt, err = buildSystemPrompt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt, "Current directory:\n- Path: ") || !strings.Contains(prompt, "Rust crate (Cargo.toml)") {
+		t.Fatalf("context missing from prompt:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "(Cargo.toml)\n- Files: Cargo.toml\n\nExamples:") {
+		t.Fatalf("context not followed by examples:\n%s", prompt)
+	}
+
+	noContextFlag = true
+	prompt, err = buildSystemPrompt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(prompt, "Current directory:") {
+		t.Fatal("--no-context should drop the directory context")
+	}
+}